@@ -0,0 +1,318 @@
+package graphiteapi
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTimeInvalid       = errors.New("invalid time")
+	ErrTimeOffsetInvalid = errors.New("invalid time offset")
+	// ErrTimezoneRequired is returned, if result depends on server timezone, but query timezone is not set
+	ErrTimezoneRequired = errors.New("timezone required")
+)
+
+var (
+	atMonths   = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	atWeekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+func isDigits(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func indexOf(a []string, s string) int {
+	for i := range a {
+		if a[i] == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// date returns time in loc and checks, that date is valid (not normalized by time.Date)
+func date(year int, month time.Month, day, hour, minute int, loc *time.Location) (time.Time, error) {
+	t := time.Date(year, month, day, hour, minute, 0, 0, loc)
+	if t.Year() != year || t.Month() != month || t.Day() != day || t.Hour() != hour || t.Minute() != minute {
+		return time.Time{}, ErrTimeInvalid
+	}
+	return t, nil
+}
+
+// ParseATTime parses graphite time spec (compatible with graphite-web parseATTime), like `-5min`, `now-1d`,
+// `20:00_20231012`, `midnight yesterday`, `1468339853`.
+// Time spec is parsed in loc (time.Local, if nil) relative to now (time.Now(), if zero).
+func ParseATTime(s string, loc *time.Location, now time.Time) (time.Time, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	if now.IsZero() {
+		now = time.Now()
+	}
+	now = now.In(loc)
+
+	spec := normalizeATTime(s)
+
+	if isDigits(spec) {
+		if len(spec) == 8 && spec[:4] > "1900" && spec[4:6] < "13" && spec[6:] < "32" {
+			// YYYYMMDD, not a timestamp
+		} else {
+			ts, err := strconv.ParseInt(spec, 10, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("%w: %s", ErrTimeInvalid, s)
+			}
+			return time.Unix(ts, 0).In(loc), nil
+		}
+	} else if strings.Contains(spec, ":") && len(spec) == 13 {
+		// HH:MMYYYYMMDD
+		t, err := time.ParseInLocation("15:0420060102", spec, loc)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w: %s", ErrTimeInvalid, s)
+		}
+		return t, nil
+	}
+
+	ref, offset := splitATTime(spec)
+	t, err := parseTimeReference(ref, loc, now)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s", err, s)
+	}
+	d, err := ParseTimeOffset(offset)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s", err, s)
+	}
+	return t.Add(d), nil
+}
+
+// normalizeATTime returns time spec in lower case without separators
+func normalizeATTime(s string) string {
+	return strings.NewReplacer("_", "", ",", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(s)))
+}
+
+// splitATTime splits normalized time spec into reference and offset
+func splitATTime(spec string) (ref, offset string) {
+	if n := strings.IndexByte(spec, '+'); n >= 0 {
+		return spec[:n], spec[n:]
+	}
+	if n := strings.IndexByte(spec, '-'); n >= 0 {
+		return spec[:n], spec[n:]
+	}
+	return spec, ""
+}
+
+// isZoneIndependentATTime checks, that time spec doesn't depend on timezone (unix timestamp or offset from now)
+func isZoneIndependentATTime(s string) bool {
+	spec := normalizeATTime(s)
+	if isDigits(spec) {
+		// YYYYMMDD is a date
+		return !(len(spec) == 8 && spec[:4] > "1900" && spec[4:6] < "13" && spec[6:] < "32")
+	}
+	ref, _ := splitATTime(spec)
+	return ref == "" || ref == "now"
+}
+
+// parseTimeReference parses reference part of time spec, like `now`, `noon yesterday`, `6pm today`, `monday`, `jan1`
+func parseTimeReference(ref string, loc *time.Location, now time.Time) (time.Time, error) {
+	if ref == "" || ref == "now" {
+		return now, nil
+	}
+
+	var (
+		hour, minute int
+		err          error
+	)
+
+	// time of day reference
+	if i := strings.IndexByte(ref, ':'); i > 0 && i < 3 {
+		if len(ref) < i+3 {
+			return time.Time{}, ErrTimeInvalid
+		}
+		if hour, err = strconv.Atoi(ref[:i]); err != nil {
+			return time.Time{}, ErrTimeInvalid
+		}
+		if minute, err = strconv.Atoi(ref[i+1 : i+3]); err != nil {
+			return time.Time{}, ErrTimeInvalid
+		}
+		ref = ref[i+3:]
+		if strings.HasPrefix(ref, "am") {
+			ref = ref[2:]
+		} else if strings.HasPrefix(ref, "pm") {
+			hour = (hour + 12) % 24
+			ref = ref[2:]
+		}
+	}
+	// Xam or XXam
+	if i := strings.Index(ref, "am"); i > 0 && i < 3 {
+		if hour, err = strconv.Atoi(ref[:i]); err != nil {
+			return time.Time{}, ErrTimeInvalid
+		}
+		ref = ref[i+2:]
+	}
+	// Xpm or XXpm
+	if i := strings.Index(ref, "pm"); i > 0 && i < 3 {
+		if hour, err = strconv.Atoi(ref[:i]); err != nil {
+			return time.Time{}, ErrTimeInvalid
+		}
+		hour = (hour + 12) % 24
+		ref = ref[i+2:]
+	}
+	if strings.HasPrefix(ref, "noon") {
+		hour, minute = 12, 0
+		ref = ref[4:]
+	} else if strings.HasPrefix(ref, "midnight") {
+		hour, minute = 0, 0
+		ref = ref[8:]
+	} else if strings.HasPrefix(ref, "teatime") {
+		hour, minute = 16, 0
+		ref = ref[7:]
+	}
+
+	year, month, day := now.Date()
+
+	// day reference
+	switch {
+	case ref == "" || ref == "today":
+	case ref == "yesterday":
+		day--
+	case ref == "tomorrow":
+		day++
+	case strings.Count(ref, "/") == 2:
+		// MM/DD/YY[YY]
+		parts := strings.Split(ref, "/")
+		var m int
+		if m, err = strconv.Atoi(parts[0]); err != nil {
+			return time.Time{}, ErrTimeInvalid
+		}
+		if day, err = strconv.Atoi(parts[1]); err != nil {
+			return time.Time{}, ErrTimeInvalid
+		}
+		if year, err = strconv.Atoi(parts[2]); err != nil {
+			return time.Time{}, ErrTimeInvalid
+		}
+		if year < 1900 {
+			year += 1900
+		}
+		if year < 1970 {
+			year += 100
+		}
+		return date(year, time.Month(m), day, hour, minute, loc)
+	case len(ref) == 8 && isDigits(ref):
+		// YYYYMMDD
+		year, _ = strconv.Atoi(ref[:4])
+		m, _ := strconv.Atoi(ref[4:6])
+		day, _ = strconv.Atoi(ref[6:])
+		return date(year, time.Month(m), day, hour, minute, loc)
+	case len(ref) >= 3 && indexOf(atMonths, ref[:3]) >= 0:
+		// MonthName DayOfMonth
+		m := indexOf(atMonths, ref[:3]) + 1
+		if len(ref) >= 2 && isDigits(ref[len(ref)-2:]) {
+			day, _ = strconv.Atoi(ref[len(ref)-2:])
+		} else if isDigits(ref[len(ref)-1:]) {
+			day, _ = strconv.Atoi(ref[len(ref)-1:])
+		} else {
+			return time.Time{}, fmt.Errorf("%w: day of month required after month name", ErrTimeInvalid)
+		}
+		return date(year, time.Month(m), day, hour, minute, loc)
+	case len(ref) >= 3 && indexOf(atWeekdays, ref[:3]) >= 0:
+		// DayOfWeek (Monday, etc), last such day (or today)
+		dayOffset := int(now.Weekday()) - indexOf(atWeekdays, ref[:3])
+		if dayOffset < 0 {
+			dayOffset += 7
+		}
+		day -= dayOffset
+	default:
+		return time.Time{}, fmt.Errorf("%w: unknown day reference", ErrTimeInvalid)
+	}
+
+	return time.Date(year, month, day, hour, minute, 0, 0, loc), nil
+}
+
+// getUnitDuration returns duration of time offset unit (month is 30 days, year is 365 days)
+func getUnitDuration(unit string) (time.Duration, error) {
+	switch {
+	case strings.HasPrefix(unit, "s"):
+		return time.Second, nil
+	case strings.HasPrefix(unit, "min"):
+		return time.Minute, nil
+	case strings.HasPrefix(unit, "h"):
+		return time.Hour, nil
+	case strings.HasPrefix(unit, "d"):
+		return 24 * time.Hour, nil
+	case strings.HasPrefix(unit, "w"):
+		return 7 * 24 * time.Hour, nil
+	case strings.HasPrefix(unit, "mon"):
+		return 30 * 24 * time.Hour, nil
+	case strings.HasPrefix(unit, "m"):
+		return time.Minute, nil
+	case strings.HasPrefix(unit, "y"):
+		return 365 * 24 * time.Hour, nil
+	default:
+		return 0, fmt.Errorf("%w: unit '%s'", ErrTimeOffsetInvalid, unit)
+	}
+}
+
+// ParseTimeOffset parses graphite time offset (compatible with graphite-web parseTimeOffset), like `-5min`, `+1d2h`, `1w`
+func ParseTimeOffset(offset string) (time.Duration, error) {
+	offset = strings.ToLower(offset)
+	if offset == "" {
+		return 0, nil
+	}
+
+	var (
+		d    time.Duration
+		sign time.Duration = 1
+	)
+	switch offset[0] {
+	case '+':
+		offset = offset[1:]
+	case '-':
+		sign = -1
+		offset = offset[1:]
+	default:
+		if offset[0] < '0' || offset[0] > '9' {
+			return 0, fmt.Errorf("%w: sign '%c'", ErrTimeOffsetInvalid, offset[0])
+		}
+	}
+
+	for len(offset) > 0 {
+		i := 0
+		for i < len(offset) && offset[i] >= '0' && offset[i] <= '9' {
+			i++
+		}
+		num, err := strconv.ParseInt(offset[:i], 10, 64)
+		if err != nil {
+			return 0, ErrTimeOffsetInvalid
+		}
+		offset = offset[i:]
+
+		i = 0
+		for i < len(offset) && offset[i] >= 'a' && offset[i] <= 'z' {
+			i++
+		}
+		unit, err := getUnitDuration(offset[:i])
+		if err != nil {
+			return 0, err
+		}
+		offset = offset[i:]
+
+		d += sign * time.Duration(num) * unit
+	}
+
+	return d, nil
+}
+
+// FormatATTime formats time as graphite time spec (unix timestamp)
+func FormatATTime(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
@@ -0,0 +1,133 @@
+package graphiteapi
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseATTime(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skip(err)
+	}
+	now := time.Date(2023, 10, 12, 15, 30, 45, 0, loc) // Thursday
+	tests := []struct {
+		s       string
+		loc     *time.Location
+		want    time.Time
+		wantErr bool
+	}{
+		{s: "now", want: now},
+		{s: "", want: now},
+		{s: "-5min", want: now.Add(-5 * time.Minute)},
+		{s: "now-1d", want: now.Add(-24 * time.Hour)},
+		{s: "now+1h30min", want: now.Add(90 * time.Minute)},
+		{s: "-1w", want: now.Add(-7 * 24 * time.Hour)},
+		{s: "-1mon", want: now.Add(-30 * 24 * time.Hour)},
+		{s: "-1y", want: now.Add(-365 * 24 * time.Hour)},
+		{s: "1697113845", want: time.Unix(1697113845, 0)},
+		{s: "20:00_20231012", want: time.Date(2023, 10, 12, 20, 0, 0, 0, loc)},
+		{s: "20231011", want: time.Date(2023, 10, 11, 0, 0, 0, 0, loc)},
+		{s: "midnight yesterday", want: time.Date(2023, 10, 11, 0, 0, 0, 0, loc)},
+		{s: "noon tomorrow", want: time.Date(2023, 10, 13, 12, 0, 0, 0, loc)},
+		{s: "teatime", want: time.Date(2023, 10, 12, 16, 0, 0, 0, loc)},
+		{s: "6pm today", want: time.Date(2023, 10, 12, 18, 0, 0, 0, loc)},
+		{s: "9:15am yesterday", want: time.Date(2023, 10, 11, 9, 15, 0, 0, loc)},
+		{s: "9:15pm", want: time.Date(2023, 10, 12, 21, 15, 0, 0, loc)},
+		{s: "10/01/23", want: time.Date(2023, 10, 1, 0, 0, 0, 0, loc)},
+		{s: "10/01/2023", want: time.Date(2023, 10, 1, 0, 0, 0, 0, loc)},
+		{s: "jan1", want: time.Date(2023, 1, 1, 0, 0, 0, 0, loc)},
+		{s: "March 15", want: time.Date(2023, 3, 15, 0, 0, 0, 0, loc)},
+		{s: "monday", want: time.Date(2023, 10, 9, 0, 0, 0, 0, loc)},
+		{s: "thursday", want: time.Date(2023, 10, 12, 0, 0, 0, 0, loc)},
+		{s: "midnight-1d", want: time.Date(2023, 10, 11, 0, 0, 0, 0, loc)},
+		{s: "20:00_20231012", loc: time.UTC, want: time.Date(2023, 10, 12, 20, 0, 0, 0, time.UTC)},
+		{s: "02/30/2023", wantErr: true},
+		{s: "jan", wantErr: true},
+		{s: "someday", wantErr: true},
+		{s: "-5", wantErr: true},
+		{s: "-5parsecs", wantErr: true},
+		{s: "-min", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			l := tt.loc
+			if l == nil {
+				l = loc
+			}
+			got, err := ParseATTime(tt.s, l, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseATTime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrTimeInvalid) && !errors.Is(err, ErrTimeOffsetInvalid) {
+					t.Errorf("ParseATTime() error = %v, must be ErrTimeInvalid or ErrTimeOffsetInvalid", err)
+				}
+			} else if !got.Equal(tt.want) {
+				t.Errorf("ParseATTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderQuery_TimeRange(t *testing.T) {
+	now := time.Date(2023, 10, 12, 15, 30, 45, 0, time.UTC)
+	q := NewRenderQuery("", "", "", []string{"a.b"}, 0)
+	from, until, err := q.TimeRange(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !from.Equal(now.Add(-24*time.Hour)) || !until.Equal(now) {
+		t.Errorf("TimeRange() = [%v, %v), want [%v, %v)", from, until, now.Add(-24*time.Hour), now)
+	}
+
+	q.SetFromTime(now.Add(-time.Hour)).SetUntil("now-5min")
+	if q.From != "1697121045" {
+		t.Errorf("SetFromTime() = %s, want %s", q.From, "1697121045")
+	}
+	from, until, err = q.TimeRange(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !from.Equal(now.Add(-time.Hour)) || !until.Equal(now.Add(-5*time.Minute)) {
+		t.Errorf("TimeRange() = [%v, %v), want [%v, %v)", from, until, now.Add(-time.Hour), now.Add(-5*time.Minute))
+	}
+}
+
+func TestRenderQuery_TimeRangeTimezone(t *testing.T) {
+	now := time.Date(2023, 10, 12, 15, 30, 45, 0, time.UTC)
+	tests := []struct {
+		from    string
+		until   string
+		tz      string
+		want    time.Time
+		wantErr bool
+	}{
+		{from: "-1h", until: "now", want: now.Add(-time.Hour)},
+		{from: "1697121045", until: "now-5min", want: now.Add(-time.Hour)},
+		{from: "20:00_20231011", until: "now", wantErr: true},
+		{from: "midnight", until: "now", wantErr: true},
+		{from: "-1h", until: "20231012", wantErr: true},
+		{from: "20:00_20231011", until: "now", tz: "Europe/Moscow", want: time.Date(2023, 10, 11, 17, 0, 0, 0, time.UTC)},
+		{from: "midnight", until: "now", tz: "UTC", want: time.Date(2023, 10, 12, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+"_"+tt.until+"_"+tt.tz, func(t *testing.T) {
+			q := NewRenderQuery("", tt.from, tt.until, []string{"a.b"}, 0).SetTz(tt.tz)
+			from, _, err := q.TimeRange(now)
+			if tt.wantErr {
+				if !errors.Is(err, ErrTimezoneRequired) {
+					t.Fatalf("TimeRange() error = %v, want %v", err, ErrTimezoneRequired)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !from.Equal(tt.want) {
+				t.Errorf("TimeRange() from = %v, want %v", from, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package graphiteapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buger/jsonparser"
+)
+
+// ErrAuthToken is returned, if access token can't be obtained
+var ErrAuthToken = errors.New("access token request failed")
+
+// Authenticator authenticates requests to graphite server (sets Authorization or other headers).
+// Authenticate is called before each request attempt, request context can be used for token requests.
+// Authenticator must be safe for concurrent use.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// AuthenticatorFunc is an adapter to use function as Authenticator
+type AuthenticatorFunc func(req *http.Request) error
+
+// Authenticate implements Authenticator interface
+func (f AuthenticatorFunc) Authenticate(req *http.Request) error {
+	return f(req)
+}
+
+type basicAuth struct {
+	username string
+	password string
+}
+
+// BasicAuth returns Authenticator for basic auth
+func BasicAuth(username, password string) Authenticator {
+	return basicAuth{username: username, password: password}
+}
+
+func (a basicAuth) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(a.username, a.password)
+	return nil
+}
+
+type bearerToken string
+
+// BearerToken returns Authenticator for static bearer token
+func BearerToken(token string) Authenticator {
+	return bearerToken(token)
+}
+
+func (t bearerToken) Authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+string(t))
+	return nil
+}
+
+type apiKey struct {
+	header string
+	key    string
+}
+
+// APIKey returns Authenticator for API key in header (like X-API-Key)
+func APIKey(header, key string) Authenticator {
+	return apiKey{header: header, key: key}
+}
+
+func (a apiKey) Authenticate(req *http.Request) error {
+	req.Header.Set(a.header, a.key)
+	return nil
+}
+
+// DefaultTokenExpiryDelta is a default time before token expiration, when token is refreshed
+const DefaultTokenExpiryDelta = 30 * time.Second
+
+// OAuth2ClientCredentials is an Authenticator for OAuth2 client credentials grant (RFC 6749, section 4.4).
+// Access token is cached and refreshed before expiration.
+type OAuth2ClientCredentials struct {
+	TokenURL       string
+	ClientID       string
+	ClientSecret   string
+	Scopes         []string
+	EndpointParams url.Values    // additional token request parameters (like audience)
+	AuthInBody     bool          // send client credentials in request body instead of basic auth
+	HTTPClient     *http.Client  // http client for token requests, http.DefaultClient if nil
+	ExpiryDelta    time.Duration // refresh token before expiration, DefaultTokenExpiryDelta if not set
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time // zero for token without expiration
+}
+
+// NewOAuth2ClientCredentials returns OAuth2ClientCredentials authenticator
+func NewOAuth2ClientCredentials(tokenURL, clientID, clientSecret string, scopes ...string) *OAuth2ClientCredentials {
+	return &OAuth2ClientCredentials{
+		TokenURL:     tokenURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+	}
+}
+
+// Authenticate implements Authenticator interface
+func (a *OAuth2ClientCredentials) Authenticate(req *http.Request) error {
+	token, err := a.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Token returns cached access token or requests new one, if token is expired (or will be expired soon)
+func (a *OAuth2ClientCredentials) Token(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	expiryDelta := a.ExpiryDelta
+	if expiryDelta <= 0 {
+		expiryDelta = DefaultTokenExpiryDelta
+	}
+	if a.token != "" && (a.expires.IsZero() || time.Now().Add(expiryDelta).Before(a.expires)) {
+		return a.token, nil
+	}
+
+	token, expiresIn, err := a.requestToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	a.token = token
+	if expiresIn > 0 {
+		a.expires = time.Now().Add(expiresIn)
+	} else {
+		a.expires = time.Time{}
+	}
+	return a.token, nil
+}
+
+// Invalidate drops cached token, so new token is requested for next request
+func (a *OAuth2ClientCredentials) Invalidate() {
+	a.mu.Lock()
+	a.token = ""
+	a.mu.Unlock()
+}
+
+// requestToken requests new access token, returns token and expiration interval (0 if not set)
+func (a *OAuth2ClientCredentials) requestToken(ctx context.Context) (string, time.Duration, error) {
+	form := url.Values{}
+	for k, v := range a.EndpointParams {
+		form[k] = v
+	}
+	form.Set("grant_type", "client_credentials")
+	if len(a.Scopes) > 0 {
+		form.Set("scope", strings.Join(a.Scopes, " "))
+	}
+	if a.AuthInBody {
+		form.Set("client_id", a.ClientID)
+		form.Set("client_secret", a.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !a.AuthInBody {
+		req.SetBasicAuth(url.QueryEscape(a.ClientID), url.QueryEscape(a.ClientSecret))
+	}
+
+	httpClient := a.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return "", 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg := parseErrorMessage(body, resp.Header.Get("Content-Type"))
+		if desc, err := jsonparser.GetString(body, "error_description"); err == nil {
+			msg += ": " + desc
+		}
+		return "", 0, fmt.Errorf("%w: status %d: %s", ErrAuthToken, resp.StatusCode, msg)
+	}
+
+	token, err := jsonparser.GetString(body, "access_token")
+	if err != nil || token == "" {
+		return "", 0, fmt.Errorf("%w: access_token not found in response", ErrAuthToken)
+	}
+	if tokenType, err := jsonparser.GetString(body, "token_type"); err == nil && !strings.EqualFold(tokenType, "bearer") {
+		return "", 0, fmt.Errorf("%w: unsupported token type %s", ErrAuthToken, tokenType)
+	}
+	var expiresIn time.Duration
+	if v, err := jsonparser.GetInt(body, "expires_in"); err == nil && v > 0 {
+		expiresIn = time.Duration(v) * time.Second
+	}
+	return token, expiresIn, nil
+}
+
+type authenticatorKey struct{}
+
+// withAuthenticator returns request with authenticator, which overrides client authenticator (for query-level auth)
+func withAuthenticator(req *http.Request, auth Authenticator) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), authenticatorKey{}, auth))
+}
+
+// requestAuthenticator returns authenticator, set for request, or client authenticator
+func requestAuthenticator(req *http.Request, auth Authenticator) Authenticator {
+	if a, ok := req.Context().Value(authenticatorKey{}).(Authenticator); ok {
+		return a
+	}
+	return auth
+}
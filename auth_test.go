@@ -0,0 +1,187 @@
+package graphiteapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const authTestResponse = `[{"target": "a.b", "datapoints": [[1, 1468339853]]}]`
+
+// newAuthServer returns render server, which checks header and responds with 401 for unexpected value
+func newAuthServer(t *testing.T, header string, want func() string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get(header); got != want() {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("unauthorized\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(authTestResponse))
+	}))
+}
+
+func TestClient_Authenticator(t *testing.T) {
+	tests := []struct {
+		name   string
+		auth   Authenticator
+		header string
+		want   string
+	}{
+		{name: "basic", auth: BasicAuth("user", "pass"), header: "Authorization", want: "Basic dXNlcjpwYXNz"},
+		{name: "bearer", auth: BearerToken("token"), header: "Authorization", want: "Bearer token"},
+		{name: "api key", auth: APIKey("X-API-Key", "key"), header: "X-API-Key", want: "key"},
+		{
+			name: "func",
+			auth: AuthenticatorFunc(func(req *http.Request) error {
+				req.Header.Set("X-Auth", "custom")
+				return nil
+			}),
+			header: "X-Auth", want: "custom",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newAuthServer(t, tt.header, func() string { return tt.want })
+			defer ts.Close()
+
+			client := NewClient("http://" + ts.Listener.Addr().String()).SetAuthenticator(tt.auth)
+			if _, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Request(context.Background()); err != nil {
+				t.Fatalf("Request() error = %v", err)
+			}
+
+			// unauthenticated
+			client.SetAuthenticator(nil)
+			_, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Request(context.Background())
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+				t.Fatalf("Request() error = %v, want status 401", err)
+			}
+		})
+	}
+}
+
+func TestRenderQuery_BasicAuthOverride(t *testing.T) {
+	ts := newAuthServer(t, "Authorization", func() string { return "Basic cXVlcnk6cGFzcw==" })
+	defer ts.Close()
+
+	client := NewClient("http://" + ts.Listener.Addr().String()).SetAuthenticator(BearerToken("token"))
+	q := client.NewRenderQuery("", "", []string{"a.b"}, 0)
+	q.SetBasicAuth("query", "pass")
+	if _, err := q.Request(context.Background()); err != nil {
+		t.Fatalf("Request() error = %v", err)
+	}
+}
+
+// newTokenServer returns OAuth2 token server, which issues tokens token-1, token-2, ... with expiresIn
+func newTokenServer(t *testing.T, expiresIn int, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm() error = %v", err)
+		}
+		if grant := r.PostForm.Get("grant_type"); grant != "client_credentials" {
+			t.Errorf("grant_type = %q, want client_credentials", grant)
+		}
+		if scope := r.PostForm.Get("scope"); scope != "read write" {
+			t.Errorf("scope = %q, want %q", scope, "read write")
+		}
+		if id, secret, ok := r.BasicAuth(); !ok || id != "id" || secret != "secret" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "invalid_client", "error_description": "bad credentials"}`))
+			return
+		}
+		n := atomic.AddInt32(requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token": "token-%d", "token_type": "Bearer", "expires_in": %d}`, n, expiresIn)
+	}))
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	var requests int32
+	tokenServer := newTokenServer(t, 3600, &requests)
+	defer tokenServer.Close()
+
+	var token atomic.Value
+	token.Store("Bearer token-1")
+	ts := newAuthServer(t, "Authorization", func() string { return token.Load().(string) })
+	defer ts.Close()
+
+	auth := NewOAuth2ClientCredentials(tokenServer.URL, "id", "secret", "read", "write")
+	client := NewClient("http://" + ts.Listener.Addr().String()).SetAuthenticator(auth)
+	for i := 0; i < 3; i++ {
+		if _, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Request(context.Background()); err != nil {
+			t.Fatalf("Request() error = %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("token requests = %d, want 1 (token must be cached)", n)
+	}
+
+	// token revoked, 401 invalidates cached token
+	token.Store("Bearer token-2")
+	if _, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Request(context.Background()); err == nil {
+		t.Fatal("Request() with revoked token must fail")
+	}
+	if _, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Request(context.Background()); err != nil {
+		t.Fatalf("Request() error = %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Fatalf("token requests = %d, want 2", n)
+	}
+}
+
+func TestOAuth2ClientCredentials_Refresh(t *testing.T) {
+	var requests int32
+	// token expires in 2s, refreshed 1s before expiration
+	tokenServer := newTokenServer(t, 2, &requests)
+	defer tokenServer.Close()
+
+	auth := NewOAuth2ClientCredentials(tokenServer.URL, "id", "secret", "read", "write")
+	auth.ExpiryDelta = time.Second
+
+	for _, want := range []string{"token-1", "token-1"} {
+		got, err := auth.Token(context.Background())
+		if err != nil {
+			t.Fatalf("Token() error = %v", err)
+		}
+		if got != want {
+			t.Fatalf("Token() = %q, want %q", got, want)
+		}
+	}
+	time.Sleep(1100 * time.Millisecond)
+	got, err := auth.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if got != "token-2" {
+		t.Fatalf("Token() = %q, want refreshed token-2", got)
+	}
+}
+
+func TestOAuth2ClientCredentials_Error(t *testing.T) {
+	var requests int32
+	tokenServer := newTokenServer(t, 3600, &requests)
+	defer tokenServer.Close()
+
+	var renderRequests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&renderRequests, 1)
+	}))
+	defer ts.Close()
+
+	auth := NewOAuth2ClientCredentials(tokenServer.URL, "id", "invalid", "read", "write")
+	client := NewClient("http://" + ts.Listener.Addr().String()).SetAuthenticator(auth)
+	_, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Request(context.Background())
+	if !errors.Is(err, ErrAuthToken) {
+		t.Fatalf("Request() error = %v, want %v", err, ErrAuthToken)
+	}
+	if n := atomic.LoadInt32(&renderRequests); n != 0 {
+		t.Fatalf("render requests = %d, want 0", n)
+	}
+}
@@ -0,0 +1,199 @@
+package graphiteapi
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BalanceStrategy is a strategy for choosing backend from multiple graphite servers
+type BalanceStrategy int8
+
+const (
+	BalanceRoundRobin   BalanceStrategy = iota // round-robin across healthy backends
+	BalanceLeastLatency                        // backend with the least average latency (not measured backends are preferred)
+	BalancePriority                            // first healthy backend in order (failover)
+)
+
+const (
+	// DefaultMaxFails is a default count of consecutive failures before backend ejection
+	DefaultMaxFails = 3
+	// DefaultCooldown is a default backend ejection time
+	DefaultCooldown = 30 * time.Second
+
+	// latencyDecay is a weight of new latency for moving average
+	latencyDecay = 0.3
+)
+
+// backend is a graphite server with passive health tracking
+type backend struct {
+	base   string
+	url    *url.URL
+	urlErr error
+
+	// protected by backendPool.mu
+	fails        int           // consecutive failures
+	ejectedUntil time.Time     // backend is ejected until
+	latency      time.Duration // moving average of successful requests latency
+}
+
+// backendPool chooses backends with strategy and tracks their health
+type backendPool struct {
+	mu       sync.Mutex
+	backends []*backend
+	strategy BalanceStrategy
+	maxFails int
+	cooldown time.Duration
+	next     int // next backend for round-robin
+}
+
+func newBackendPool(bases []string, strategy BalanceStrategy, maxFails int, cooldown time.Duration) *backendPool {
+	p := &backendPool{
+		backends: make([]*backend, len(bases)),
+		strategy: strategy,
+		maxFails: maxFails,
+		cooldown: cooldown,
+	}
+	for i, base := range bases {
+		base = strings.TrimRight(base, "/")
+		b := &backend{base: base}
+		b.url, b.urlErr = url.Parse(base)
+		p.backends[i] = b
+	}
+	return p
+}
+
+func (p *backendPool) setEjection(maxFails int, cooldown time.Duration) {
+	p.mu.Lock()
+	p.maxFails = maxFails
+	p.cooldown = cooldown
+	p.mu.Unlock()
+}
+
+func isBackendExcluded(b *backend, exclude []*backend) bool {
+	for _, e := range exclude {
+		if b == e {
+			return true
+		}
+	}
+	return false
+}
+
+// pick chooses backend with strategy, healthy and not excluded backends are preferred
+func (p *backendPool) pick(exclude []*backend) *backend {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	candidates := make([]*backend, 0, len(p.backends))
+	for _, b := range p.backends {
+		if now.After(b.ejectedUntil) && !isBackendExcluded(b, exclude) {
+			candidates = append(candidates, b)
+		}
+	}
+	if len(candidates) == 0 {
+		// all backends are ejected or excluded, try not excluded with the earliest ejection end
+		var found *backend
+		for _, b := range p.backends {
+			if !isBackendExcluded(b, exclude) && (found == nil || b.ejectedUntil.Before(found.ejectedUntil)) {
+				found = b
+			}
+		}
+		if found == nil {
+			found = p.backends[0]
+		}
+		return found
+	}
+
+	switch p.strategy {
+	case BalancePriority:
+		return candidates[0]
+	case BalanceLeastLatency:
+		found := candidates[0]
+		for _, b := range candidates[1:] {
+			if b.latency < found.latency {
+				found = b
+			}
+		}
+		return found
+	default:
+		b := candidates[p.next%len(candidates)]
+		p.next++
+		return b
+	}
+}
+
+// report updates backend health after request
+func (p *backendPool) report(b *backend, latency time.Duration, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if failed {
+		b.fails++
+		if p.maxFails > 0 && b.fails >= p.maxFails {
+			b.ejectedUntil = time.Now().Add(p.cooldown)
+			b.fails = 0
+		}
+		return
+	}
+	b.fails = 0
+	b.ejectedUntil = time.Time{}
+	if b.latency == 0 {
+		b.latency = latency
+	} else {
+		b.latency = time.Duration(latencyDecay*float64(latency) + (1-latencyDecay)*float64(b.latency))
+	}
+}
+
+// isBackendFailure checks, if request result must be tracked as backend failure (network error or gateway errors)
+func isBackendFailure(ctx context.Context, statusCode int, err error) bool {
+	if ctx.Err() != nil {
+		// request was canceled by caller
+		return false
+	}
+	switch statusCode {
+	case 0:
+		return err != nil
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// rewriteURL replaces base url prefix from in u with to base url. Returns nil, if u is not started from from.
+func rewriteURL(u, from, to *url.URL) *url.URL {
+	if u.Scheme != from.Scheme || u.Host != from.Host || !strings.HasPrefix(u.Path, from.Path) {
+		return nil
+	}
+	r := *u
+	r.Scheme = to.Scheme
+	r.Host = to.Host
+	r.User = to.User
+	r.Path = to.Path + strings.TrimPrefix(u.Path, from.Path)
+	r.RawPath = ""
+	return &r
+}
+
+// ResponseInfo describes how request was executed
+type ResponseInfo struct {
+	Backend    string // base url of backend, answered for the last attempt
+	Attempts   int    // count of attempts
+	StatusCode int    // http status code of the last attempt, 0 on network error
+	Hedged     bool   // the last attempt was answered by hedged request
+}
+
+type responseInfoKey struct{}
+
+// WithResponseInfo returns context, which collects info about request execution into info
+func WithResponseInfo(ctx context.Context, info *ResponseInfo) context.Context {
+	return context.WithValue(ctx, responseInfoKey{}, info)
+}
+
+func responseInfoFromContext(ctx context.Context) *ResponseInfo {
+	info, _ := ctx.Value(responseInfoKey{}).(*ResponseInfo)
+	return info
+}
@@ -0,0 +1,133 @@
+package graphiteapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testBackend struct {
+	ts       *httptest.Server
+	base     string
+	requests int32
+}
+
+func newTestBackends(t *testing.T, n int, delay []time.Duration, status []int) []*testBackend {
+	backends := make([]*testBackend, n)
+	for i := range backends {
+		b := &testBackend{}
+		i := i
+		b.ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&b.requests, 1)
+			if r.URL.Path != "/graphite/render/" {
+				t.Errorf("Path should be `/graphite/render/` but %s found", r.URL.Path)
+			}
+			if i < len(delay) {
+				time.Sleep(delay[i])
+			}
+			if i < len(status) && status[i] != 200 {
+				w.WriteHeader(status[i])
+				return
+			}
+			w.Header().Set("Content-type", "application/json")
+			w.Write([]byte("[]"))
+		}))
+		b.base = "http://" + b.ts.Listener.Addr().String() + "/graphite"
+		backends[i] = b
+	}
+	return backends
+}
+
+func testBackendsBases(backends []*testBackend) []string {
+	bases := make([]string, len(backends))
+	for i, b := range backends {
+		bases[i] = b.base
+	}
+	return bases
+}
+
+func closeTestBackends(backends []*testBackend) {
+	for _, b := range backends {
+		b.ts.Close()
+	}
+}
+
+func TestClient_BackendsRoundRobin(t *testing.T) {
+	backends := newTestBackends(t, 3, nil, nil)
+	defer closeTestBackends(backends)
+
+	client := NewClient("").SetBackends(testBackendsBases(backends), BalanceRoundRobin)
+	for i := 0; i < 9; i++ {
+		var info ResponseInfo
+		ctx := WithResponseInfo(context.Background(), &info)
+		if _, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Request(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if want := backends[i%3].base; info.Backend != want {
+			t.Errorf("[%d] request answered by %s, want %s", i, info.Backend, want)
+		}
+	}
+	for i, b := range backends {
+		if b.requests != 3 {
+			t.Errorf("backend %d got %d requests, want 3", i, b.requests)
+		}
+	}
+}
+
+func TestClient_BackendsPriorityFailover(t *testing.T) {
+	backends := newTestBackends(t, 3, nil, []int{200, 503, 200})
+	defer closeTestBackends(backends)
+	// first backend is down
+	backends[0].ts.Close()
+
+	client := NewClient("").SetBackends(testBackendsBases(backends), BalancePriority).SetEjection(2, time.Minute)
+	for i := 0; i < 4; i++ {
+		var info ResponseInfo
+		ctx := WithResponseInfo(context.Background(), &info)
+		if _, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Request(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if info.Backend != backends[2].base {
+			t.Errorf("[%d] request answered by %s, want %s", i, info.Backend, backends[2].base)
+		}
+	}
+	// failed backends are ejected after 2 failures
+	if backends[1].requests != 2 {
+		t.Errorf("backend 1 got %d requests, want 2", backends[1].requests)
+	}
+	if backends[2].requests != 4 {
+		t.Errorf("backend 2 got %d requests, want 4", backends[2].requests)
+	}
+}
+
+func TestClient_BackendsLeastLatency(t *testing.T) {
+	backends := newTestBackends(t, 2, []time.Duration{50 * time.Millisecond, 0}, nil)
+	defer closeTestBackends(backends)
+
+	client := NewClient("").SetBackends(testBackendsBases(backends), BalanceLeastLatency)
+	for i := 0; i < 10; i++ {
+		if _, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Request(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if backends[0].requests != 1 || backends[1].requests != 9 {
+		t.Errorf("backends got %d and %d requests, want 1 and 9", backends[0].requests, backends[1].requests)
+	}
+}
+
+func Test_rewriteURL(t *testing.T) {
+	from, _ := url.Parse("http://a:8080/graphite")
+	to, _ := url.Parse("https://b/api/graphite")
+	u, _ := url.Parse("http://a:8080/graphite/render/?target=a.b")
+	if got := rewriteURL(u, from, to).String(); got != "https://b/api/graphite/render/?target=a.b" {
+		t.Errorf("rewriteURL() = %s", got)
+	}
+	u, _ = url.Parse("http://c:8080/graphite/render/?target=a.b")
+	if got := rewriteURL(u, from, to); got != nil {
+		t.Errorf("rewriteURL() = %s, want nil", got)
+	}
+}
@@ -0,0 +1,29 @@
+package graphiteapi
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledBufferSize limits size of buffers, returned to pool (huge buffers are released to GC)
+const maxPooledBufferSize = 64 * 1024 * 1024
+
+// bufferPool is a pool of buffers for reading response bodies
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// putBuffer returns buffer to pool, buffer data must not be used after it
+func putBuffer(buf *bytes.Buffer) {
+	if buf == nil || buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
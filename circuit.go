@@ -0,0 +1,171 @@
+package graphiteapi
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without request, if circuit breaker for backend host is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is a circuit breaker state
+type CircuitState int8
+
+const (
+	CircuitClosed   CircuitState = iota // requests are allowed, failures are counted
+	CircuitOpen                         // requests are rejected with ErrCircuitOpen
+	CircuitHalfOpen                     // single probe request is allowed per probe interval
+)
+
+var circuitStateStrings = []string{"closed", "open", "half-open"}
+
+func (s CircuitState) String() string {
+	if s < 0 || int(s) >= len(circuitStateStrings) {
+		return fmt.Sprintf("CircuitState(%d)", s)
+	}
+	return circuitStateStrings[s]
+}
+
+const (
+	// DefaultCircuitFailureRate is a default failure rate for open circuit
+	DefaultCircuitFailureRate = 0.5
+	// DefaultCircuitMinRequests is a default count of requests in window before failure rate check
+	DefaultCircuitMinRequests = 10
+	// DefaultCircuitWindow is a default count of recent requests for failure rate
+	DefaultCircuitWindow = 20
+	// DefaultCircuitProbeInterval is a default interval between probe requests to backend with open circuit
+	DefaultCircuitProbeInterval = 10 * time.Second
+)
+
+// CircuitBreakerPolicy describes circuit breaker for each backend host.
+// Network errors, attempt timeouts and gateway errors (502, 503, 504) are counted as failures.
+// Circuit is opened, when failure rate of the last Window requests reaches FailureRate.
+// After ProbeInterval circuit becomes half-open and single probe request is allowed:
+// circuit is closed on probe success or opened again on failure.
+type CircuitBreakerPolicy struct {
+	FailureRate   float64       // failure rate (0.0 - 1.0) for open circuit, DefaultCircuitFailureRate if not set
+	MinRequests   int           // min requests in window before failure rate check, DefaultCircuitMinRequests if not set
+	Window        int           // count of recent requests for failure rate, DefaultCircuitWindow if not set
+	ProbeInterval time.Duration // interval between probe requests, DefaultCircuitProbeInterval if not set
+}
+
+// circuitBreaker tracks request results for backend host
+type circuitBreaker struct {
+	state     CircuitState
+	results   []bool // ring buffer of the recent results, true for failure
+	pos       int
+	failures  int
+	nextProbe time.Time // next probe request time for open or half-open circuit
+}
+
+// circuitBreakers is a set of circuit breakers for backend hosts
+type circuitBreakers struct {
+	mu       sync.Mutex
+	policy   CircuitBreakerPolicy
+	breakers map[string]*circuitBreaker
+}
+
+func newCircuitBreakers(policy CircuitBreakerPolicy) *circuitBreakers {
+	if policy.FailureRate <= 0 {
+		policy.FailureRate = DefaultCircuitFailureRate
+	}
+	if policy.Window <= 0 {
+		policy.Window = DefaultCircuitWindow
+	}
+	if policy.MinRequests <= 0 {
+		policy.MinRequests = DefaultCircuitMinRequests
+	}
+	if policy.MinRequests > policy.Window {
+		policy.MinRequests = policy.Window
+	}
+	if policy.ProbeInterval <= 0 {
+		policy.ProbeInterval = DefaultCircuitProbeInterval
+	}
+	return &circuitBreakers{
+		policy:   policy,
+		breakers: make(map[string]*circuitBreaker),
+	}
+}
+
+func (cb *circuitBreakers) get(host string) *circuitBreaker {
+	b, ok := cb.breakers[host]
+	if !ok {
+		b = &circuitBreaker{results: make([]bool, 0, cb.policy.Window)}
+		cb.breakers[host] = b
+	}
+	return b
+}
+
+// allow checks, if request to host is allowed. Returns ErrCircuitOpen error, if not.
+func (cb *circuitBreakers) allow(host string) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	b := cb.get(host)
+	if b.state == CircuitClosed {
+		return nil
+	}
+	now := time.Now()
+	if now.Before(b.nextProbe) {
+		return fmt.Errorf("%w: %s", ErrCircuitOpen, host)
+	}
+	// probe request
+	b.state = CircuitHalfOpen
+	b.nextProbe = now.Add(cb.policy.ProbeInterval)
+	return nil
+}
+
+// report updates circuit breaker for host after request
+func (cb *circuitBreakers) report(host string, failed bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	b := cb.get(host)
+	switch b.state {
+	case CircuitHalfOpen:
+		if failed {
+			b.state = CircuitOpen
+			b.nextProbe = time.Now().Add(cb.policy.ProbeInterval)
+		} else {
+			b.state = CircuitClosed
+			b.results = b.results[:0]
+			b.pos = 0
+			b.failures = 0
+		}
+	case CircuitClosed:
+		if len(b.results) < cb.policy.Window {
+			b.results = append(b.results, failed)
+		} else {
+			if b.results[b.pos] {
+				b.failures--
+			}
+			b.results[b.pos] = failed
+			b.pos = (b.pos + 1) % cb.policy.Window
+		}
+		if failed {
+			b.failures++
+			if len(b.results) >= cb.policy.MinRequests &&
+				float64(b.failures) >= cb.policy.FailureRate*float64(len(b.results)) {
+				b.state = CircuitOpen
+				b.nextProbe = time.Now().Add(cb.policy.ProbeInterval)
+			}
+		}
+	}
+	// results of requests, started before circuit was opened, are ignored
+}
+
+func (cb *circuitBreakers) state(host string) CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	b, ok := cb.breakers[host]
+	if !ok {
+		return CircuitClosed
+	}
+	if b.state == CircuitOpen && !time.Now().Before(b.nextProbe) {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
@@ -0,0 +1,99 @@
+package graphiteapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient_CircuitBreaker(t *testing.T) {
+	var (
+		requests int32
+		status   int32 = http.StatusServiceUnavailable
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if s := int(atomic.LoadInt32(&status)); s != 200 {
+			w.WriteHeader(s)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		w.Write([]byte("[]"))
+	}))
+	defer ts.Close()
+
+	base := "http://" + ts.Listener.Addr().String()
+	client := NewClient(base).SetCircuitBreaker(&CircuitBreakerPolicy{
+		FailureRate: 0.5, MinRequests: 2, Window: 4, ProbeInterval: 100 * time.Millisecond,
+	})
+	q := client.NewRenderQuery("", "", []string{"a.b"}, 0)
+
+	for i := 0; i < 2; i++ {
+		if _, err := q.Request(context.Background()); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("[%d] Request() error = %v, want backend error", i, err)
+		}
+	}
+	if state := client.CircuitState(base); state != CircuitOpen {
+		t.Fatalf("CircuitState() = %s, want %s", state, CircuitOpen)
+	}
+	if _, err := q.Request(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Request() error = %v, want ErrCircuitOpen", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("backend got %d requests, want 2", n)
+	}
+
+	// failed probe
+	time.Sleep(150 * time.Millisecond)
+	if state := client.CircuitState(base); state != CircuitHalfOpen {
+		t.Errorf("CircuitState() = %s, want %s", state, CircuitHalfOpen)
+	}
+	if _, err := q.Request(context.Background()); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("probe Request() error = %v, want backend error", err)
+	}
+	if state := client.CircuitState(base); state != CircuitOpen {
+		t.Errorf("CircuitState() = %s, want %s", state, CircuitOpen)
+	}
+
+	// successful probe
+	atomic.StoreInt32(&status, 200)
+	time.Sleep(150 * time.Millisecond)
+	if _, err := q.Request(context.Background()); err != nil {
+		t.Errorf("probe Request() error = %v", err)
+	}
+	if state := client.CircuitState(base); state != CircuitClosed {
+		t.Errorf("CircuitState() = %s, want %s", state, CircuitClosed)
+	}
+	if n := atomic.LoadInt32(&requests); n != 4 {
+		t.Errorf("backend got %d requests, want 4", n)
+	}
+}
+
+func TestClient_CircuitBreakerBackends(t *testing.T) {
+	backends := newTestBackends(t, 2, nil, []int{http.StatusBadGateway, 200})
+	defer closeTestBackends(backends)
+
+	client := NewClient("").SetBackends(testBackendsBases(backends), BalancePriority).
+		SetEjection(0, 0).
+		SetCircuitBreaker(&CircuitBreakerPolicy{MinRequests: 2, Window: 2, ProbeInterval: time.Minute})
+	for i := 0; i < 5; i++ {
+		var info ResponseInfo
+		ctx := WithResponseInfo(context.Background(), &info)
+		if _, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Request(ctx); err != nil {
+			t.Fatalf("[%d] Request() error = %v", i, err)
+		}
+		if info.Backend != backends[1].base {
+			t.Errorf("[%d] request answered by %s, want %s", i, info.Backend, backends[1].base)
+		}
+	}
+	if state := client.CircuitState(backends[0].base); state != CircuitOpen {
+		t.Errorf("CircuitState() = %s, want %s", state, CircuitOpen)
+	}
+	if n := atomic.LoadInt32(&backends[0].requests); n != 2 {
+		t.Errorf("failed backend got %d requests, want 2", n)
+	}
+}
@@ -0,0 +1,365 @@
+package graphiteapi
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// DefaultUserAgent is sent with all requests, unless changed with SetUserAgent
+	DefaultUserAgent = "graphite-api-client/0.1"
+	// DefaultTimeout is the default timeout for a single request
+	DefaultTimeout = 5 * time.Second
+	// DefaultMaxURLLength is the default max length of render url, longer render queries are sent with POST
+	DefaultMaxURLLength = 2048
+)
+
+// Client holds settings for talking with a graphite server: base url, auth, headers, transport and timeouts.
+// All queries are executed with some client (DefaultClient, if not set).
+// Client is safe for concurrent use.
+type Client struct {
+	mu sync.RWMutex
+
+	base        string        // base url of graphite server
+	auth        Authenticator // authenticator for all requests, nil if not set
+	userAgent   string
+	headers     http.Header
+	httpClient  *http.Client
+	timeout     time.Duration    // request timeout, 0 for no timeout (except httpClient.Timeout)
+	retry       *RetryPolicy     // retry policy, nil for no retries
+	pool        *backendPool     // multiple backends, nil for single base url
+	maxFails    int              // consecutive failures before backend ejection
+	cooldown    time.Duration    // backend ejection time
+	hedge       *hedger          // hedged requests, nil if disabled
+	breakers    *circuitBreakers // circuit breakers for backend hosts, nil if disabled
+	limiter     *limiter         // rate and concurrency limits, nil if not set
+	maxURLLen   int              // max render url length for GET, 0 for unlimited
+	compression bool             // request compressed (zstd or gzip) responses
+	middlewares []Middleware     // middleware chain for request attempts
+
+	tracerProvider trace.TracerProvider          // OpenTelemetry tracer provider, global if not set
+	propagator     propagation.TextMapPropagator // trace context propagator, global if not set
+}
+
+// DefaultClient is used by queries, created without client (NewRenderQuery, NewRenderEval, etc.)
+var DefaultClient = NewClient("")
+
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout: 1 * time.Second,
+			}).DialContext,
+			MaxIdleConnsPerHost: 5,
+		},
+	}
+}
+
+// NewClient returns a Client instance for graphite server with base url
+func NewClient(base string) *Client {
+	return &Client{
+		base:        strings.TrimRight(base, "/"),
+		userAgent:   DefaultUserAgent,
+		headers:     make(http.Header),
+		httpClient:  newHTTPClient(),
+		timeout:     DefaultTimeout,
+		maxFails:    DefaultMaxFails,
+		cooldown:    DefaultCooldown,
+		maxURLLen:   DefaultMaxURLLength,
+		compression: true,
+	}
+}
+
+// Base returns base url of graphite server
+func (c *Client) Base() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.base
+}
+
+// SetBase sets base url of graphite server (and resets backends, if set)
+func (c *Client) SetBase(base string) *Client {
+	c.mu.Lock()
+	c.base = strings.TrimRight(base, "/")
+	c.pool = nil
+	c.mu.Unlock()
+	return c
+}
+
+// SetBackends sets base urls of multiple graphite servers, requests are balanced with strategy.
+// Failed requests are retried on other backends, backends are ejected after consecutive failures (see SetEjection).
+// The first backend is used as base url for build queries urls.
+func (c *Client) SetBackends(bases []string, strategy BalanceStrategy) *Client {
+	if len(bases) == 0 {
+		return c
+	}
+	c.mu.Lock()
+	c.base = strings.TrimRight(bases[0], "/")
+	c.pool = newBackendPool(bases, strategy, c.maxFails, c.cooldown)
+	c.mu.Unlock()
+	return c
+}
+
+// Backends returns base urls of graphite servers
+func (c *Client) Backends() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.pool == nil {
+		return []string{c.base}
+	}
+	bases := make([]string, len(c.pool.backends))
+	for i, b := range c.pool.backends {
+		bases[i] = b.base
+	}
+	return bases
+}
+
+// SetEjection sets passive health tracking for backends: backend is ejected for cooldown after maxFails consecutive failures
+// (network errors and 502, 503, 504 statuses). maxFails 0 disables ejection.
+func (c *Client) SetEjection(maxFails int, cooldown time.Duration) *Client {
+	c.mu.Lock()
+	c.maxFails = maxFails
+	c.cooldown = cooldown
+	if c.pool != nil {
+		c.pool.setEjection(maxFails, cooldown)
+	}
+	c.mu.Unlock()
+	return c
+}
+
+// SetBasicAuth sets basic auth credentials for all requests (can be overridden by query), empty username disables auth
+func (c *Client) SetBasicAuth(username, password string) *Client {
+	if username == "" {
+		return c.SetAuthenticator(nil)
+	}
+	return c.SetAuthenticator(BasicAuth(username, password))
+}
+
+// SetAuthenticator sets authenticator for all requests (can be overridden by query), nil disables auth
+func (c *Client) SetAuthenticator(auth Authenticator) *Client {
+	c.mu.Lock()
+	c.auth = auth
+	c.mu.Unlock()
+	return c
+}
+
+// SetUserAgent sets a custom user agent
+func (c *Client) SetUserAgent(ua string) *Client {
+	c.mu.Lock()
+	c.userAgent = ua
+	c.mu.Unlock()
+	return c
+}
+
+// AddHeader adds a custom header on all requests
+func (c *Client) AddHeader(key, value string) *Client {
+	if http.CanonicalHeaderKey(key) == "User-Agent" {
+		return c.SetUserAgent(value)
+	}
+	c.mu.Lock()
+	c.headers.Add(key, value)
+	c.mu.Unlock()
+	return c
+}
+
+// SetHeader sets a custom header on all requests, replacing any existing values
+func (c *Client) SetHeader(key, value string) *Client {
+	if http.CanonicalHeaderKey(key) == "User-Agent" {
+		return c.SetUserAgent(value)
+	}
+	c.mu.Lock()
+	c.headers.Set(key, value)
+	c.mu.Unlock()
+	return c
+}
+
+// DelHeader deletes a custom header
+func (c *Client) DelHeader(key string) *Client {
+	c.mu.Lock()
+	c.headers.Del(key)
+	c.mu.Unlock()
+	return c
+}
+
+// SetHTTPClient sets the http client used to make requests
+func (c *Client) SetHTTPClient(client *http.Client) *Client {
+	c.mu.Lock()
+	c.httpClient = client
+	c.mu.Unlock()
+	return c
+}
+
+// SetTransport sets the transport of the http client used to make requests
+func (c *Client) SetTransport(transport http.RoundTripper) *Client {
+	c.mu.Lock()
+	httpClient := *c.httpClient
+	httpClient.Transport = transport
+	c.httpClient = &httpClient
+	c.mu.Unlock()
+	return c
+}
+
+// SetTimeout sets the timeout for a single request (or attempt with retries), 0 disables it.
+// For streamed responses (RenderQuery.Stream) timeout is applied till response headers, body read is limited by context.
+func (c *Client) SetTimeout(timeout time.Duration) *Client {
+	c.mu.Lock()
+	c.timeout = timeout
+	c.mu.Unlock()
+	return c
+}
+
+// SetRetryPolicy sets retry policy for all requests, nil disables retries.
+// Timeout is applied for each attempt, total request time is limited by context.
+func (c *Client) SetRetryPolicy(retry *RetryPolicy) *Client {
+	c.mu.Lock()
+	c.retry = retry
+	c.mu.Unlock()
+	return c
+}
+
+// SetHedging enables hedged requests for multiple backends, nil disables hedging.
+// Hedge counters are reset.
+func (c *Client) SetHedging(policy *HedgePolicy) *Client {
+	c.mu.Lock()
+	if policy == nil {
+		c.hedge = nil
+	} else {
+		c.hedge = newHedger(*policy)
+	}
+	c.mu.Unlock()
+	return c
+}
+
+// HedgeStats returns hedged requests counters
+func (c *Client) HedgeStats() HedgeStats {
+	c.mu.RLock()
+	h := c.hedge
+	c.mu.RUnlock()
+	if h == nil {
+		return HedgeStats{}
+	}
+	return h.stats()
+}
+
+// SetCircuitBreaker enables circuit breaker for each backend host, nil disables it.
+// Requests to backend host with open circuit fail fast with ErrCircuitOpen (or go to other backend, if multiple backends are set).
+func (c *Client) SetCircuitBreaker(policy *CircuitBreakerPolicy) *Client {
+	c.mu.Lock()
+	if policy == nil {
+		c.breakers = nil
+	} else {
+		c.breakers = newCircuitBreakers(*policy)
+	}
+	c.mu.Unlock()
+	return c
+}
+
+// CircuitState returns circuit breaker state for backend base url (CircuitClosed, if circuit breaker is disabled)
+func (c *Client) CircuitState(base string) CircuitState {
+	c.mu.RLock()
+	breakers := c.breakers
+	c.mu.RUnlock()
+	if breakers == nil {
+		return CircuitClosed
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return CircuitClosed
+	}
+	return breakers.state(u.Host)
+}
+
+// setLimiter replaces limiter with new one (in-flight requests are not counted by new limiter)
+func (c *Client) setLimiter(client *limit, backend *Limits) {
+	if client == nil && backend == nil {
+		c.limiter = nil
+		return
+	}
+	c.limiter = &limiter{client: client, backend: backend, backends: make(map[string]*limit)}
+}
+
+// SetLimits sets client-wide rate and concurrency limits, nil disables them.
+// Requests wait for limits until context is done.
+func (c *Client) SetLimits(limits *Limits) *Client {
+	c.mu.Lock()
+	var (
+		client  *limit
+		backend *Limits
+	)
+	if limits != nil {
+		client = newLimit(*limits)
+	}
+	if c.limiter != nil {
+		backend = c.limiter.backend
+	}
+	c.setLimiter(client, backend)
+	c.mu.Unlock()
+	return c
+}
+
+// SetBackendLimits sets rate and concurrency limits for each backend host, nil disables them.
+// Requests wait for limits until context is done.
+func (c *Client) SetBackendLimits(limits *Limits) *Client {
+	c.mu.Lock()
+	var client *limit
+	if c.limiter != nil {
+		client = c.limiter.client
+	}
+	if limits != nil {
+		l := *limits
+		limits = &l
+	}
+	c.setLimiter(client, limits)
+	c.mu.Unlock()
+	return c
+}
+
+// SetMaxURLLength sets max length of render url, longer render queries (with RenderMethodAuto) are sent with POST.
+// 0 disables switching to POST.
+func (c *Client) SetMaxURLLength(n int) *Client {
+	c.mu.Lock()
+	c.maxURLLen = n
+	c.mu.Unlock()
+	return c
+}
+
+// MaxURLLength returns max length of render url
+func (c *Client) MaxURLLength() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.maxURLLen
+}
+
+// SetCompression enables (by default) or disables compressed responses. If enabled, zstd or gzip encoding is requested
+// and responses are decompressed while reading. If disabled, uncompressed (identity) responses are requested.
+// Accept-Encoding header, set with AddHeader/SetHeader, overrides it.
+func (c *Client) SetCompression(enabled bool) *Client {
+	c.mu.Lock()
+	c.compression = enabled
+	c.mu.Unlock()
+	return c
+}
+
+// NewRenderQuery returns a RenderQuery instance, bound to client
+func (c *Client) NewRenderQuery(from, until string, targets []string, maxDataPoints int) *RenderQuery {
+	q := NewRenderQuery("", from, until, targets, maxDataPoints)
+	q.client = c
+	return q
+}
+
+// NewRenderEval returns a RenderEval instance, bound to client
+func (c *Client) NewRenderEval(from, until, eval string, maxDataPoints int, maxNullPoints int) (*RenderEval, error) {
+	e, err := NewRenderEval("", from, until, eval, maxDataPoints, maxNullPoints)
+	if err != nil {
+		return nil, err
+	}
+	e.q.client = c
+	return e, nil
+}
@@ -0,0 +1,69 @@
+package graphiteapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestClient_Headers(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		headers []http.Header
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Clone())
+		mu.Unlock()
+		w.Header().Set("Content-type", "application/json")
+		w.Write([]byte("[]"))
+	}))
+	defer ts.Close()
+
+	base := "http://" + ts.Listener.Addr().String()
+
+	c1 := NewClient(base).SetUserAgent("test1").AddHeader("X-Cluster", "c1").SetBasicAuth("user1", "password1")
+	c2 := NewClient(base+"/").AddHeader("X-Cluster", "c2").AddHeader("User-Agent", "test2")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := c1.NewRenderQuery("-5min", "now", []string{"a.b"}, 0).Request(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			q := c2.NewRenderQuery("-5min", "now", []string{"a.b"}, 0)
+			q.SetBasicAuth("user2", "password2")
+			if _, err := q.Request(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(headers) != 20 {
+		t.Fatalf("got %d requests, want 20", len(headers))
+	}
+	for _, h := range headers {
+		r := &http.Request{Header: h}
+		user, password, _ := r.BasicAuth()
+		switch h.Get("X-Cluster") {
+		case "c1":
+			if h.Get("User-Agent") != "test1" || user != "user1" || password != "password1" {
+				t.Errorf("c1 request has invalid headers: %+v", h)
+			}
+		case "c2":
+			if h.Get("User-Agent") != "test2" || user != "user2" || password != "password2" {
+				t.Errorf("c2 request has invalid headers: %+v", h)
+			}
+		default:
+			t.Errorf("unexpected request headers: %+v", h)
+		}
+	}
+}
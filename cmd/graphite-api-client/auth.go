@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+	"os"
+
+	graphiteapi "github.com/msaf1980/graphite-api-client"
+	"github.com/spf13/cobra"
+)
+
+type AuthCfg struct {
+	BearerToken        string
+	APIKeyHeader       string
+	APIKey             string
+	OAuth2TokenURL     string
+	OAuth2ClientID     string
+	OAuth2ClientSecret string
+	OAuth2Scopes       StringSlice
+}
+
+var authCfg = AuthCfg{}
+
+// authFlags adds authentication flags to command (secrets can be also set with env vars)
+func authFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&authCfg.BearerToken, "bearer-token", "", "bearer token (or GRAPHITE_TOKEN env var)")
+	cmd.Flags().StringVar(&authCfg.APIKeyHeader, "api-key-header", "X-API-Key", "API key header")
+	cmd.Flags().StringVar(&authCfg.APIKey, "api-key", "", "API key (or GRAPHITE_API_KEY env var)")
+	cmd.Flags().StringVar(&authCfg.OAuth2TokenURL, "oauth2-token-url", "", "OAuth2 token url for client credentials grant")
+	cmd.Flags().StringVar(&authCfg.OAuth2ClientID, "oauth2-client-id", "", "OAuth2 client id")
+	cmd.Flags().StringVar(&authCfg.OAuth2ClientSecret, "oauth2-client-secret", "", "OAuth2 client secret (or GRAPHITE_CLIENT_SECRET env var)")
+	cmd.Flags().Var(&authCfg.OAuth2Scopes, "oauth2-scope", "OAuth2 scopes")
+}
+
+// authenticator returns authenticator from flags or env vars (GRAPHITE_USERNAME and GRAPHITE_PASSWORD for basic auth).
+// OAuth2 token is requested with tlsConfig (if set), token server is usually behind the same PKI.
+func authenticator(tlsConfig *tls.Config) graphiteapi.Authenticator {
+	if authCfg.BearerToken == "" {
+		authCfg.BearerToken = os.Getenv("GRAPHITE_TOKEN")
+	}
+	if authCfg.APIKey == "" {
+		authCfg.APIKey = os.Getenv("GRAPHITE_API_KEY")
+	}
+	if authCfg.OAuth2ClientSecret == "" {
+		authCfg.OAuth2ClientSecret = os.Getenv("GRAPHITE_CLIENT_SECRET")
+	}
+
+	switch {
+	case authCfg.OAuth2TokenURL != "":
+		if authCfg.OAuth2ClientID == "" {
+			log.Fatalf("OAuth2 client id not set")
+		}
+		auth := graphiteapi.NewOAuth2ClientCredentials(authCfg.OAuth2TokenURL, authCfg.OAuth2ClientID,
+			authCfg.OAuth2ClientSecret, authCfg.OAuth2Scopes...)
+		if tlsConfig != nil {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = tlsConfig
+			auth.HTTPClient = &http.Client{Transport: transport}
+		}
+		return auth
+	case authCfg.BearerToken != "":
+		return graphiteapi.BearerToken(authCfg.BearerToken)
+	case authCfg.APIKey != "":
+		return graphiteapi.APIKey(authCfg.APIKeyHeader, authCfg.APIKey)
+	case graphiteUsername != "":
+		return graphiteapi.BasicAuth(graphiteUsername, graphitePassword)
+	default:
+		return nil
+	}
+}
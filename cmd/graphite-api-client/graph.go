@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+
+	graphiteapi "github.com/msaf1980/graphite-api-client"
+	"github.com/spf13/cobra"
+)
+
+type GraphCfg struct {
+	Base       string
+	From       string
+	Until      string
+	Targets    StringSlice
+	Format     string
+	Width      int
+	Height     int
+	Title      string
+	VTitle     string
+	ColorList  StringSlice
+	AreaMode   string
+	LineMode   string
+	Template   string
+	BgColor    string
+	HideLegend bool
+	Output     string
+}
+
+var graphCfg = GraphCfg{}
+
+func graphRun(cmd *cobra.Command, _ []string) {
+	if len(graphCfg.Base) == 0 {
+		log.Fatalf("base address not set")
+	}
+	if len(graphCfg.Targets) == 0 {
+		log.Fatalf("targets not set")
+	}
+	if len(graphCfg.Output) == 0 {
+		log.Fatalf("output file not set")
+	}
+
+	client := graphiteapi.NewClient(graphCfg.Base)
+	tlsConf := tlsConfig()
+	client.SetAuthenticator(authenticator(tlsConf))
+	setTLS(client, tlsConf)
+
+	q := client.NewGraphQuery(graphCfg.From, graphCfg.Until, graphCfg.Targets).
+		SetFormat(graphiteapi.GraphFormat(graphCfg.Format)).
+		SetSize(graphCfg.Width, graphCfg.Height).
+		SetTitle(graphCfg.Title).
+		SetVTitle(graphCfg.VTitle).
+		SetColorList(graphCfg.ColorList).
+		SetAreaMode(graphiteapi.GraphAreaMode(graphCfg.AreaMode)).
+		SetLineMode(graphiteapi.GraphLineMode(graphCfg.LineMode)).
+		SetTemplate(graphCfg.Template).
+		SetBgColor(graphCfg.BgColor)
+	if cmd.Flags().Changed("hide-legend") {
+		q.SetHideLegend(graphCfg.HideLegend)
+	}
+
+	image, err := q.Request(context.Background())
+	if err != nil {
+		log.Fatalf("Graph query error: %s", err)
+	}
+
+	if err = ioutil.WriteFile(graphCfg.Output, image.Data, 0644); err != nil {
+		log.Fatalf("Write graph error: %s", err)
+	}
+}
+
+func graphCmd(rootCmd *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "graph",
+		Short: "Get graphite api render graph image",
+		Run:   graphRun,
+	}
+
+	cmd.Flags().StringVarP(&graphCfg.Base, "base", "b", "http://127.0.0.1:8888", "base address (for basic auth set GRAPHITE_USERNAME and GRAPHITE_PASSWORD env vars)")
+	cmd.Flags().VarP(&graphCfg.Targets, "targets", "t", "targets")
+	cmd.Flags().StringVarP(&graphCfg.From, "from", "f", "", "from")
+	cmd.Flags().StringVarP(&graphCfg.Until, "until", "u", "", "until")
+	cmd.Flags().StringVar(&graphCfg.Format, "format", "png", "image format (png, svg)")
+	cmd.Flags().IntVar(&graphCfg.Width, "width", 0, "width")
+	cmd.Flags().IntVar(&graphCfg.Height, "height", 0, "height")
+	cmd.Flags().StringVar(&graphCfg.Title, "title", "", "title")
+	cmd.Flags().StringVar(&graphCfg.VTitle, "vtitle", "", "vertical title")
+	cmd.Flags().Var(&graphCfg.ColorList, "color", "series colors")
+	cmd.Flags().StringVar(&graphCfg.AreaMode, "area-mode", "", "area mode (none, first, all, stacked)")
+	cmd.Flags().StringVar(&graphCfg.LineMode, "line-mode", "", "line mode (slope, staircase, connected)")
+	cmd.Flags().StringVar(&graphCfg.Template, "template", "", "template")
+	cmd.Flags().StringVar(&graphCfg.BgColor, "bgcolor", "", "background color")
+	cmd.Flags().BoolVar(&graphCfg.HideLegend, "hide-legend", false, "hide legend")
+	cmd.Flags().StringVarP(&graphCfg.Output, "output", "o", "", "output file")
+
+	authFlags(cmd)
+	tlsFlags(cmd)
+
+	rootCmd.AddCommand(cmd)
+}
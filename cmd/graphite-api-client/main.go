@@ -22,6 +22,7 @@ func main() {
 	graphitePassword = os.Getenv("GRAPHITE_PASSWORD")
 
 	renderCmd(rootCmd)
+	graphCmd(rootCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		log.Printf("%s\n", err.Error())
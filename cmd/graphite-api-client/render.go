@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/kr/pretty"
 	graphiteapi "github.com/msaf1980/graphite-api-client"
@@ -16,6 +17,7 @@ type RootCfg struct {
 	Until         string
 	Targets       StringSlice
 	MaxDataPoints int
+	Format        string
 }
 
 var rootCfg = RootCfg{}
@@ -31,9 +33,22 @@ func renderRun(*cobra.Command, []string) {
 		log.Fatalf("max data points must be >= 0")
 	}
 
-	q := graphiteapi.NewRenderQuery(rootCfg.Base, rootCfg.From, rootCfg.Until, rootCfg.Targets, rootCfg.MaxDataPoints)
-	if graphiteUsername != "" {
-		q.SetBasicAuth(graphiteUsername, graphitePassword)
+	client := graphiteapi.NewClient(rootCfg.Base)
+	tlsConf := tlsConfig()
+	client.SetAuthenticator(authenticator(tlsConf))
+	setTLS(client, tlsConf)
+
+	q := client.NewRenderQuery(rootCfg.From, rootCfg.Until, rootCfg.Targets, rootCfg.MaxDataPoints)
+	q.SetFormat(graphiteapi.RenderFormat(rootCfg.Format))
+
+	if q.Format == graphiteapi.RenderFormatCSV {
+		// pass through csv
+		data, err := q.RequestRaw(context.Background())
+		if err != nil {
+			log.Fatalf("Render query error: %s", err)
+		}
+		os.Stdout.Write(data)
+		return
 	}
 
 	result, err := q.Request(context.Background())
@@ -56,6 +71,10 @@ func renderCmd(rootCmd *cobra.Command) {
 	cmd.Flags().StringVarP(&rootCfg.From, "from", "f", "", "from")
 	cmd.Flags().StringVarP(&rootCfg.Until, "until", "u", "", "until")
 	cmd.Flags().IntVar(&rootCfg.MaxDataPoints, "m", 0, "max data points")
+	cmd.Flags().StringVar(&rootCfg.Format, "format", "json", "format (json, pickle, protobuf, carbonapi_v3_pb, msgpack, csv)")
+
+	authFlags(cmd)
+	tlsFlags(cmd)
 
 	rootCmd.AddCommand(cmd)
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"time"
+
+	graphiteapi "github.com/msaf1980/graphite-api-client"
+	"github.com/spf13/cobra"
+)
+
+type TLSCfg struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	MinVersion         string
+	InsecureSkipVerify bool
+	ReloadInterval     time.Duration
+}
+
+var tlsCfg = TLSCfg{}
+
+// tlsFlags adds TLS flags to command
+func tlsFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&tlsCfg.CAFile, "tls-ca", "", "PEM CA bundle for server certificate verification")
+	cmd.Flags().StringVar(&tlsCfg.CertFile, "tls-cert", "", "PEM client certificate (for mutual TLS)")
+	cmd.Flags().StringVar(&tlsCfg.KeyFile, "tls-key", "", "PEM client key (for mutual TLS)")
+	cmd.Flags().StringVar(&tlsCfg.ServerName, "tls-server-name", "", "server name for certificate verification")
+	cmd.Flags().StringVar(&tlsCfg.MinVersion, "tls-min-version", "", "min TLS version (1.0, 1.1, 1.2, 1.3)")
+	cmd.Flags().BoolVar(&tlsCfg.InsecureSkipVerify, "tls-insecure", false, "don't verify server certificate")
+	cmd.Flags().DurationVar(&tlsCfg.ReloadInterval, "tls-reload", 0, "check client certificate files for changes at most once per interval (0 disables reload)")
+}
+
+// tlsConfig returns TLS config from flags (nil, if not set)
+func tlsConfig() *tls.Config {
+	if tlsCfg == (TLSCfg{}) {
+		return nil
+	}
+	minVersion, err := graphiteapi.ParseTLSVersion(tlsCfg.MinVersion)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	cfg, err := graphiteapi.NewTLSConfig(graphiteapi.TLSOptions{
+		CAFile:             tlsCfg.CAFile,
+		CertFile:           tlsCfg.CertFile,
+		KeyFile:            tlsCfg.KeyFile,
+		ServerName:         tlsCfg.ServerName,
+		MinVersion:         minVersion,
+		InsecureSkipVerify: tlsCfg.InsecureSkipVerify,
+		ReloadInterval:     tlsCfg.ReloadInterval,
+	})
+	if err != nil {
+		log.Fatalf("TLS config error: %s", err)
+	}
+	return cfg
+}
+
+// setTLS sets TLS config for client (if set)
+func setTLS(client *graphiteapi.Client, cfg *tls.Config) {
+	if cfg != nil {
+		client.SetTLSConfig(cfg)
+	}
+}
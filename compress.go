@@ -0,0 +1,82 @@
+package graphiteapi
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrContentEncoding is returned for response with unsupported Content-Encoding
+var ErrContentEncoding = errors.New("unsupported content encoding")
+
+const (
+	// acceptEncoding is sent with requests, if compression is enabled (zstd is preferred)
+	acceptEncoding = "zstd, gzip"
+	// acceptIdentity is sent with requests, if compression is disabled
+	acceptIdentity = "identity"
+)
+
+// zstdDecoderPool is a pool of zstd decoders (decoder is heavy to create)
+var zstdDecoderPool = sync.Pool{
+	New: func() interface{} {
+		d, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+		if err != nil {
+			return err
+		}
+		return d
+	},
+}
+
+// decompressReader is a response body, decompressed on the fly
+type decompressReader struct {
+	io.Reader
+	body  io.ReadCloser
+	close func()
+}
+
+func (r *decompressReader) Close() error {
+	if r.close != nil {
+		r.close()
+		r.close = nil
+	}
+	return r.body.Close()
+}
+
+// decompressBody returns response body, decompressed by Content-Encoding (gzip or zstd)
+func decompressBody(resp *http.Response) (io.ReadCloser, error) {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "", "identity":
+		return resp.Body, nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressReader{Reader: zr, body: resp.Body}, nil
+	case "zstd":
+		v := zstdDecoderPool.Get()
+		d, ok := v.(*zstd.Decoder)
+		if !ok {
+			return nil, v.(error)
+		}
+		if err := d.Reset(resp.Body); err != nil {
+			zstdDecoderPool.Put(d)
+			return nil, err
+		}
+		return &decompressReader{Reader: d, body: resp.Body, close: func() {
+			// release reference to body
+			if d.Reset(nil) == nil {
+				zstdDecoderPool.Put(d)
+			}
+		}}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrContentEncoding, encoding)
+	}
+}
@@ -0,0 +1,111 @@
+package graphiteapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func compressTestData(t *testing.T, encoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	switch encoding {
+	case "gzip":
+		w := gzip.NewWriter(&buf)
+		w.Write(data)
+		w.Close()
+	case "zstd":
+		w, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+		w.Close()
+	default:
+		return data
+	}
+	return buf.Bytes()
+}
+
+func TestClient_Compression(t *testing.T) {
+	const response = `[{"target": "a.b", "datapoints": [[1, 1468339853], [null, 1468339854]]}]`
+	want := []Series{{Target: "a.b", DataPoints: []DataPoint{{Value: 1, Timestamp: 1468339853}, {Value: math.NaN(), Timestamp: 1468339854}}}}
+
+	tests := []struct {
+		name           string
+		disabled       bool
+		header         string // Accept-Encoding header, set on client
+		encoding       string // response Content-Encoding
+		status         int
+		wantAccept     string
+		wantErr        error
+		wantAPIMessage string
+	}{
+		{name: "zstd", encoding: "zstd", wantAccept: "zstd, gzip"},
+		{name: "gzip", encoding: "gzip", wantAccept: "zstd, gzip"},
+		{name: "not compressed", wantAccept: "zstd, gzip"},
+		{name: "disabled", disabled: true, wantAccept: "identity"},
+		{name: "custom header", header: "gzip", encoding: "gzip", wantAccept: "gzip"},
+		{name: "unsupported", encoding: "br", wantAccept: "zstd, gzip", wantErr: ErrContentEncoding},
+		{name: "error body", encoding: "gzip", status: http.StatusBadRequest, wantAccept: "zstd, gzip", wantAPIMessage: "bad target"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := response
+			if tt.status != 0 {
+				body = "bad target\n"
+			}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if accept := r.Header.Get("Accept-Encoding"); accept != tt.wantAccept {
+					t.Errorf("Accept-Encoding = %q, want %q", accept, tt.wantAccept)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				w.Write(compressTestData(t, tt.encoding, []byte(body)))
+			}))
+			defer ts.Close()
+
+			client := NewClient("http://" + ts.Listener.Addr().String()).SetCompression(!tt.disabled)
+			if tt.header != "" {
+				client.SetHeader("Accept-Encoding", tt.header)
+			}
+			q := client.NewRenderQuery("", "", []string{"a.b"}, 0)
+			res, err := q.Request(context.Background())
+			if tt.wantAPIMessage != "" {
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) || apiErr.Message != tt.wantAPIMessage {
+					t.Fatalf("Request() error = %v, want APIError with message %q", err, tt.wantAPIMessage)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Request() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			compareSeries(t, res, want)
+
+			// streaming decompression
+			var streamed []Series
+			if err = q.RequestEach(context.Background(), func(s Series) error {
+				streamed = append(streamed, s)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			compareSeries(t, streamed, want)
+		})
+	}
+}
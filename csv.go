@@ -0,0 +1,51 @@
+package graphiteapi
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// csvTimeFormat is a timestamp format in csv render response
+const csvTimeFormat = "2006-01-02 15:04:05"
+
+// unmarshallCSVSeries decodes render response in csv format: rows with name, time and value (empty for null).
+// Rows for series are consecutive, timestamps are parsed in loc.
+func unmarshallCSVSeries(data []byte, maxTargets int, loc *time.Location) ([]Series, error) {
+	empty := []Series{}
+	if len(data) == 0 {
+		return empty, nil
+	}
+	result := make([]Series, 0, maxTargets)
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = 3
+	r.ReuseRecord = true
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return empty, err
+		}
+		t, err := time.ParseInLocation(csvTimeFormat, record[1], loc)
+		if err != nil {
+			return empty, fmt.Errorf("csv: series %s: %w", record[0], err)
+		}
+		v := math.NaN()
+		if record[2] != "" {
+			if v, err = strconv.ParseFloat(record[2], 64); err != nil {
+				return empty, fmt.Errorf("csv: series %s: %w", record[0], err)
+			}
+		}
+		if len(result) == 0 || result[len(result)-1].Target != record[0] {
+			result = append(result, Series{Target: record[0]})
+		}
+		series := &result[len(result)-1]
+		series.DataPoints = append(series.DataPoints, DataPoint{Value: v, Timestamp: t.Unix(), Millis: int16(t.Nanosecond() / int(time.Millisecond))})
+	}
+	return result, nil
+}
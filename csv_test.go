@@ -0,0 +1,101 @@
+package graphiteapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testCSV = `main1,2016-07-12 16:10:00,1.0
+main1,2016-07-12 16:11:00,
+main1,2016-07-12 16:12:00,2.5
+"main2,a",2016-07-12 16:10:00,3
+"main2,a",2016-07-12 16:11:00,
+"main2,a",2016-07-12 16:12:00,-1.5
+`
+
+func TestRenderQuery_RequestCSV(t *testing.T) {
+	var wantTz string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if format := r.URL.Query().Get("format"); format != "csv" {
+			t.Errorf("Format should be csv but %s found", format)
+		}
+		if tz := r.URL.Query().Get("tz"); tz != wantTz {
+			t.Errorf("Timezone should be %q but %q found", wantTz, tz)
+		}
+		w.Header().Set("Content-type", "text/csv")
+		fmt.Fprint(w, testCSV)
+	}))
+	defer ts.Close()
+
+	// timezone is not overridden, raw response is in server timezone
+	q := NewClient("http://"+ts.Listener.Addr().String()).NewRenderQuery("", "", []string{"main*"}, 0).SetFormat(RenderFormatCSV)
+	raw, err := q.RequestRaw(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != testCSV {
+		t.Errorf("- %s\n+ %s", testCSV, string(raw))
+	}
+	// timestamps can't be decoded without timezone
+	if _, err = q.Request(context.Background()); !errors.Is(err, ErrTimezoneRequired) {
+		t.Fatalf("Request() without timezone error = %v, want %v", err, ErrTimezoneRequired)
+	}
+
+	wantTz = "UTC"
+	q.SetTz("UTC")
+	res, err := q.Request(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareSeries(t, res, []Series{
+		{
+			Target: "main1",
+			DataPoints: []DataPoint{
+				{Value: 1.0, Timestamp: 1468339800},
+				{Value: math.NaN(), Timestamp: 1468339860},
+				{Value: 2.5, Timestamp: 1468339920},
+			},
+		},
+		{
+			Target: "main2,a",
+			DataPoints: []DataPoint{
+				{Value: 3.0, Timestamp: 1468339800},
+				{Value: math.NaN(), Timestamp: 1468339860},
+				{Value: -1.5, Timestamp: 1468339920},
+			},
+		},
+	})
+}
+
+func TestRenderQuery_CSVTimezone(t *testing.T) {
+	for _, tz := range []string{"", "Europe/Moscow"} {
+		q := NewRenderQuery("http://127.0.0.1:8080", "20:00_20231012", "now", []string{"a.b"}, 0).SetTz(tz)
+		jsonURL, err := q.SetFormat(RenderFormatJSON).URL()
+		if err != nil {
+			t.Fatal(err)
+		}
+		csvURL, err := q.SetFormat(RenderFormatCSV).URL()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// from/until must be parsed by server in the same timezone for all formats
+		if jsonTz, csvTz := jsonURL.Query()["tz"], csvURL.Query()["tz"]; fmt.Sprint(jsonTz) != fmt.Sprint(csvTz) {
+			t.Errorf("tz %q: json url tz = %q, csv url tz = %q", tz, jsonTz, csvTz)
+		}
+	}
+}
+
+func TestUnmarshallCSVSeries_Millis(t *testing.T) {
+	series, err := unmarshallCSVSeries([]byte("main1,2016-07-12 16:10:00.250,1.0\n"), 0, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Series{{Target: "main1", DataPoints: []DataPoint{{Value: 1, Timestamp: 1468339800, Millis: 250}}}}
+	compareSeries(t, series, want)
+}
@@ -0,0 +1,213 @@
+package graphiteapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/buger/jsonparser"
+)
+
+var (
+	// ErrContentType is a cause of APIError for successful response with unexpected content type
+	ErrContentType = errors.New("unexpected content type")
+
+	ErrDatapointInvalid   = errors.New("invalid datapoint") // datapoint is not a [value, timestamp] array
+	ErrDatapointValue     = errors.New("invalid datapoint value")
+	ErrDatapointTimestamp = errors.New("invalid datapoint timestamp")
+)
+
+const (
+	// MaxErrorBodySize is a max size of response body, saved in APIError
+	MaxErrorBodySize = 1024
+	// maxErrorMessageSize is a max size of parsed error message
+	maxErrorMessageSize = 256
+)
+
+// APIError is returned for unsuccessful graphite API response (or successful response with unexpected content type)
+type APIError struct {
+	StatusCode  int    // http status code
+	ContentType string // response content type
+	Endpoint    string // request url path, like /render/
+	Body        string // response body, truncated to MaxErrorBodySize
+	Message     string // error message, parsed from carbonapi/graphite-web response body
+	Err         error  // cause, like ErrContentType (nil for unsuccessful status code)
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("graphite api %s: status %d", e.Endpoint, e.StatusCode)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error() + " " + e.ContentType
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// DatapointError describes malformed datapoint in render response
+type DatapointError struct {
+	Target string // series target, empty if not decoded
+	Index  int    // datapoint index in series
+	Err    error  // ErrDatapointInvalid, ErrDatapointValue or ErrDatapointTimestamp
+}
+
+func (e *DatapointError) Error() string {
+	return fmt.Sprintf("target %q: datapoint %d: %v", e.Target, e.Index, e.Err)
+}
+
+func (e *DatapointError) Unwrap() error {
+	return e.Err
+}
+
+// newAPIError returns APIError for response
+func newAPIError(req *http.Request, resp *http.Response, body []byte, cause error) *APIError {
+	e := &APIError{
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Endpoint:    req.URL.Path,
+		Message:     parseErrorMessage(body, resp.Header.Get("Content-Type")),
+		Err:         cause,
+	}
+	if len(body) > MaxErrorBodySize {
+		e.Body = string(body[:MaxErrorBodySize])
+	} else {
+		e.Body = string(body)
+	}
+	return e
+}
+
+// isContentType checks media type of Content-Type header value (parameters, like charset, are ignored)
+func isContentType(value string, contentTypes ...string) bool {
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		return false
+	}
+	for _, contentType := range contentTypes {
+		if mediaType == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	htmlTitleRe = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	htmlTagRe   = regexp.MustCompile(`(?s)<[^>]*>`)
+	spacesRe    = regexp.MustCompile(`\s+`)
+)
+
+// parseErrorMessage extracts error message from response body:
+// json error (like {"error": "..."} or {"errors": {"target": "..."}}), html page title or the first line of text
+func parseErrorMessage(body []byte, contentType string) string {
+	body = []byte(strings.TrimSpace(string(body)))
+	if len(body) == 0 {
+		return ""
+	}
+	var msg string
+	switch {
+	case isContentType(contentType, "application/json") || body[0] == '{':
+		msg = parseJSONErrorMessage(body)
+	case isContentType(contentType, "text/html") || body[0] == '<':
+		if m := htmlTitleRe.FindSubmatch(body); m != nil {
+			msg = string(m[1])
+		} else {
+			msg = htmlTagRe.ReplaceAllString(string(body), " ")
+		}
+	}
+	if msg == "" {
+		msg = string(body)
+		if n := strings.IndexByte(msg, '\n'); n > 0 {
+			msg = msg[:n]
+		}
+	}
+	msg = strings.TrimSpace(spacesRe.ReplaceAllString(msg, " "))
+	if len(msg) > maxErrorMessageSize {
+		msg = msg[:maxErrorMessageSize] + "..."
+	}
+	return msg
+}
+
+func parseJSONErrorMessage(body []byte) string {
+	for _, key := range []string{"error", "message", "errors"} {
+		value, dataType, _, err := jsonparser.Get(body, key)
+		if err != nil {
+			continue
+		}
+		switch dataType {
+		case jsonparser.String:
+			if s, err := jsonparser.ParseString(value); err == nil {
+				return s
+			}
+		case jsonparser.Object:
+			// graphite-web validation errors: {"errors": {"param": "message"}}
+			var msgs []string
+			_ = jsonparser.ObjectEach(value, func(k []byte, v []byte, dataType jsonparser.ValueType, offset int) error {
+				msgs = append(msgs, string(k)+": "+string(v))
+				return nil
+			})
+			return strings.Join(msgs, "; ")
+		case jsonparser.Array:
+			var msgs []string
+			_, _ = jsonparser.ArrayEach(value, func(v []byte, dataType jsonparser.ValueType, offset int, err error) {
+				msgs = append(msgs, string(v))
+			})
+			return strings.Join(msgs, "; ")
+		}
+	}
+	return ""
+}
+
+// IsNotFound checks, if error is an APIError with 404 status code
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// IsTimeout checks, if error is a request timeout (client-side or gateway timeout status code)
+func IsTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusGatewayTimeout || apiErr.StatusCode == http.StatusRequestTimeout
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// badTargetMessages are error messages, returned by graphite-web with 500 status code for invalid targets
+var badTargetMessages = []string{"ParseException", "InputParameterError", "unknown function"}
+
+// IsBadTarget checks, if error is caused by invalid request (like bad target or unknown function), not by server outage
+func IsBadTarget(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.StatusCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return true
+	case http.StatusInternalServerError:
+		// body is truncated, so message (parsed from full body) is checked too
+		for _, msg := range badTargetMessages {
+			if strings.Contains(apiErr.Body, msg) || strings.Contains(apiErr.Message, msg) {
+				return true
+			}
+		}
+	}
+	return false
+}
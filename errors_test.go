@@ -0,0 +1,200 @@
+package graphiteapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClient_APIError(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		wantErr     bool
+		wantStatus  int
+		wantMessage string
+		wantCause   error
+		notFound    bool
+		timeout     bool
+		badTarget   bool
+	}{
+		{
+			name:        "ok with charset",
+			status:      200,
+			contentType: "application/json; charset=utf-8",
+			body:        "[]",
+		},
+		{
+			name:        "not found",
+			status:      404,
+			contentType: "text/plain",
+			body:        "404 page not found\n",
+			wantErr:     true,
+			wantStatus:  404,
+			wantMessage: "404 page not found",
+			notFound:    true,
+		},
+		{
+			name:        "carbonapi bad target",
+			status:      400,
+			contentType: "text/plain; charset=utf-8",
+			body:        "failed to parse target: unexpected end of input\ntarget: sum(a.b\n",
+			wantErr:     true,
+			wantStatus:  400,
+			wantMessage: "failed to parse target: unexpected end of input",
+			badTarget:   true,
+		},
+		{
+			name:        "graphite-web validation",
+			status:      400,
+			contentType: "application/json",
+			body:        `{"errors": {"maxDataPoints": "Invalid int value"}}`,
+			wantErr:     true,
+			wantStatus:  400,
+			wantMessage: `maxDataPoints: Invalid int value`,
+			badTarget:   true,
+		},
+		{
+			name:        "graphite-web parse exception",
+			status:      500,
+			contentType: "text/html",
+			body:        "<html><head><title>ParseException at /render/</title></head><body><h1>ParseException</h1></body></html>",
+			wantErr:     true,
+			wantStatus:  500,
+			wantMessage: "ParseException at /render/",
+			badTarget:   true,
+		},
+		{
+			name:        "gateway timeout",
+			status:      504,
+			contentType: "text/html",
+			body:        "<html><body><h1>504 Gateway Time-out</h1></body></html>",
+			wantErr:     true,
+			wantStatus:  504,
+			wantMessage: "504 Gateway Time-out",
+			timeout:     true,
+		},
+		{
+			name:        "wrong content type",
+			status:      200,
+			contentType: "text/html",
+			body:        "<html><head><title>Login</title></head></html>",
+			wantErr:     true,
+			wantStatus:  200,
+			wantMessage: "Login",
+			wantCause:   ErrContentType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer ts.Close()
+
+			client := NewClient("http://" + ts.Listener.Addr().String())
+			_, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Request(context.Background())
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Request() error = %v", err)
+				}
+				return
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("Request() error = %v, want *APIError", err)
+			}
+			if apiErr.StatusCode != tt.wantStatus {
+				t.Errorf("APIError.StatusCode = %d, want %d", apiErr.StatusCode, tt.wantStatus)
+			}
+			if apiErr.Endpoint != "/render/" {
+				t.Errorf("APIError.Endpoint = %q, want %q", apiErr.Endpoint, "/render/")
+			}
+			if apiErr.ContentType != tt.contentType {
+				t.Errorf("APIError.ContentType = %q, want %q", apiErr.ContentType, tt.contentType)
+			}
+			if apiErr.Message != tt.wantMessage {
+				t.Errorf("APIError.Message = %q, want %q", apiErr.Message, tt.wantMessage)
+			}
+			if apiErr.Body != tt.body {
+				t.Errorf("APIError.Body = %q, want %q", apiErr.Body, tt.body)
+			}
+			if !errors.Is(err, tt.wantCause) && tt.wantCause != nil {
+				t.Errorf("Request() error = %v, want %v", err, tt.wantCause)
+			}
+			if IsNotFound(err) != tt.notFound {
+				t.Errorf("IsNotFound() = %v, want %v", IsNotFound(err), tt.notFound)
+			}
+			if IsTimeout(err) != tt.timeout {
+				t.Errorf("IsTimeout() = %v, want %v", IsTimeout(err), tt.timeout)
+			}
+			if IsBadTarget(err) != tt.badTarget {
+				t.Errorf("IsBadTarget() = %v, want %v", IsBadTarget(err), tt.badTarget)
+			}
+		})
+	}
+}
+
+func TestAPIError_TruncatedBody(t *testing.T) {
+	body := strings.Repeat("x", 2*MaxErrorBodySize)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	_, err := NewClient("http://"+ts.Listener.Addr().String()).NewRenderQuery("", "", []string{"a.b"}, 0).Request(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Request() error = %v, want *APIError", err)
+	}
+	if len(apiErr.Body) != MaxErrorBodySize {
+		t.Errorf("len(APIError.Body) = %d, want %d", len(apiErr.Body), MaxErrorBodySize)
+	}
+	if len(apiErr.Message) > maxErrorMessageSize+3 {
+		t.Errorf("len(APIError.Message) = %d, want not more than %d", len(apiErr.Message), maxErrorMessageSize+3)
+	}
+}
+
+func TestIsBadTarget_TruncatedBody(t *testing.T) {
+	// graphite-web debug page: error is in title after large inline styles
+	body := "<html><head><style>" + strings.Repeat("body { color: black; }\n", MaxErrorBodySize/8) + "</style>" +
+		"<title>ParseException at /render/</title></head><body></body></html>"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	_, err := NewClient("http://"+ts.Listener.Addr().String()).NewRenderQuery("", "", []string{"a.b("}, 0).Request(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Request() error = %v, want *APIError", err)
+	}
+	if strings.Contains(apiErr.Body, "ParseException") {
+		t.Fatal("APIError.Body must be truncated before error")
+	}
+	if !IsBadTarget(err) {
+		t.Errorf("IsBadTarget() = false, want true (message %q)", apiErr.Message)
+	}
+}
+
+func TestIsTimeout(t *testing.T) {
+	if !IsTimeout(context.DeadlineExceeded) {
+		t.Error("IsTimeout(context.DeadlineExceeded) = false")
+	}
+	if IsTimeout(context.Canceled) {
+		t.Error("IsTimeout(context.Canceled) = true")
+	}
+	if IsTimeout(nil) {
+		t.Error("IsTimeout(nil) = true")
+	}
+}
@@ -96,6 +96,11 @@ func (e *RenderEval) SetBasicAuth(username, password string) {
 	e.q.SetBasicAuth(username, password)
 }
 
+// SetClient sets client, used for requests
+func (e *RenderEval) SetClient(client *Client) {
+	e.q.SetClient(client)
+}
+
 func (e *RenderEval) String() string {
 	return e.eval
 }
@@ -0,0 +1,124 @@
+package graphiteapi
+
+import (
+	"context"
+	"net/url"
+)
+
+// NewExpandQuery returns a ExpandQuery instance, bound to client
+func (c *Client) NewExpandQuery(queries []string) *ExpandQuery {
+	return &ExpandQuery{
+		Queries: queries,
+		client:  c,
+	}
+}
+
+// Client returns client, used for requests
+func (q *ExpandQuery) Client() *Client {
+	if q.client == nil {
+		return DefaultClient
+	}
+	return q.client
+}
+
+func (q *ExpandQuery) SetQueries(queries []string) *ExpandQuery {
+	q.Queries = queries
+	return q
+}
+
+func (q *ExpandQuery) AddQuery(query string) *ExpandQuery {
+	q.Queries = append(q.Queries, query)
+	return q
+}
+
+func (q *ExpandQuery) SetGroupByExpr(groupByExpr bool) *ExpandQuery {
+	q.GroupByExpr = groupByExpr
+	return q
+}
+
+func (q *ExpandQuery) SetLeavesOnly(leavesOnly bool) *ExpandQuery {
+	q.LeavesOnly = leavesOnly
+	return q
+}
+
+// URL returns query url
+func (q *ExpandQuery) URL() (*url.URL, error) {
+	u, err := url.Parse(q.Client().Base() + "/metrics/expand")
+	if err != nil {
+		return nil, err
+	}
+	v := url.Values{}
+
+	for _, query := range q.Queries {
+		v.Add("query", query)
+	}
+
+	if q.GroupByExpr {
+		v.Set("groupByExpr", "1")
+	}
+
+	if q.LeavesOnly {
+		v.Set("leavesOnly", "1")
+	}
+
+	u.RawQuery = v.Encode()
+
+	return u, nil
+}
+
+// Request do `/metrics/expand` request and returns expanded paths
+func (q *ExpandQuery) Request(ctx context.Context) (*ExpandResult, error) {
+	result := &ExpandResult{}
+	if err := q.Client().request(ctx, q, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Unmarshal implements Response interface
+func (r *ExpandResult) Unmarshal(data []byte) error {
+	paths, groups, err := unmarshallExpand(data)
+	if err != nil {
+		return err
+	}
+	r.Paths = paths
+	r.Groups = groups
+	return nil
+}
+
+// NewIndexQuery returns a IndexQuery instance, bound to client
+func (c *Client) NewIndexQuery() *IndexQuery {
+	return &IndexQuery{client: c}
+}
+
+// Client returns client, used for requests
+func (q *IndexQuery) Client() *Client {
+	if q.client == nil {
+		return DefaultClient
+	}
+	return q.client
+}
+
+// URL returns query url
+func (q *IndexQuery) URL() (*url.URL, error) {
+	return url.Parse(q.Client().Base() + "/metrics/index.json")
+}
+
+// Request do `/metrics/index.json` request and returns all metrics names
+func (q *IndexQuery) Request(ctx context.Context) (MetricsIndex, error) {
+	var index MetricsIndex
+	if err := q.Client().request(ctx, q, &index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// Unmarshal implements Response interface
+func (m *MetricsIndex) Unmarshal(data []byte) error {
+	index, err := unmarshallStrings(data)
+	if err != nil {
+		return err
+	}
+	*m = index
+	return nil
+}
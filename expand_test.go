@@ -0,0 +1,102 @@
+package graphiteapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestExpandQuery_URL(t *testing.T) {
+	q := NewClient("http://domain.tld/path").NewExpandQuery([]string{"a.*", "b.*"}).SetGroupByExpr(true).SetLeavesOnly(true)
+	shouldUrl := "http://domain.tld/path/metrics/expand?groupByExpr=1&leavesOnly=1&query=a.%2A&query=b.%2A"
+	url, err := q.URL()
+	if err != nil {
+		t.Fatalf("Resulting URL is nil, error is '%v'", err)
+	}
+	gotUrl := url.String()
+	if shouldUrl != gotUrl {
+		t.Errorf("Resulting URL is %v, \n but should be %v", gotUrl, shouldUrl)
+	}
+}
+
+func makeJSONServer(t *testing.T, path, expectedQuery, result string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parsedQuery, _ := url.ParseQuery(expectedQuery)
+		if !reflect.DeepEqual(r.URL.Query(), parsedQuery) {
+			t.Errorf("Expected query is %+v but %+v got", parsedQuery, r.URL.Query())
+		}
+		if r.URL.Path != path {
+			t.Errorf("Path should be `%s` but %s found", path, r.URL.Path)
+		}
+		w.Header().Set("Content-type", "application/json")
+		fmt.Fprintln(w, result)
+	}))
+}
+
+var expandTestCases = []struct {
+	Queries       []string
+	GroupByExpr   bool
+	ExpectedQuery string
+	Result        string
+	Want          *ExpandResult
+}{
+	{
+		Queries:       []string{"a.*", "b.*"},
+		ExpectedQuery: "query=a.*&query=b.*",
+		Result:        `{"results": ["a.b", "a.c", "b.c"]}`,
+		Want:          &ExpandResult{Paths: []string{"a.b", "a.c", "b.c"}},
+	},
+	{
+		Queries:       []string{"a.*", "b.*"},
+		GroupByExpr:   true,
+		ExpectedQuery: "groupByExpr=1&query=a.*&query=b.*",
+		Result:        `{"results": {"a.*": ["a.b", "a.c"], "b.*": ["b.c"]}}`,
+		Want: &ExpandResult{Groups: map[string][]string{
+			"a.*": {"a.b", "a.c"},
+			"b.*": {"b.c"},
+		}},
+	},
+	{
+		Queries:       []string{"c.*"},
+		ExpectedQuery: "query=c.*",
+		Result:        `{"results": []}`,
+		Want:          &ExpandResult{Paths: []string{}},
+	},
+}
+
+func TestExpandQuery_Request(t *testing.T) {
+	for i, tt := range expandTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ts := makeJSONServer(t, "/metrics/expand", tt.ExpectedQuery, tt.Result)
+			defer ts.Close()
+
+			q := NewClient("http://" + ts.Listener.Addr().String()).NewExpandQuery(tt.Queries).SetGroupByExpr(tt.GroupByExpr)
+			res, err := q.Request(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(res, tt.Want) {
+				t.Errorf("- %+v\n+ %+v", tt.Want, res)
+			}
+		})
+	}
+}
+
+func TestIndexQuery_Request(t *testing.T) {
+	ts := makeJSONServer(t, "/metrics/index.json", "", `["a.b", "a.c", "b.c"]`)
+	defer ts.Close()
+
+	res, err := NewClient("http://" + ts.Listener.Addr().String()).NewIndexQuery().Request(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := MetricsIndex{"a.b", "a.c", "b.c"}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("- %+v\n+ %+v", want, res)
+	}
+}
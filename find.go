@@ -0,0 +1,113 @@
+package graphiteapi
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+// NewFindQuery returns a FindQuery instance, bound to client
+func (c *Client) NewFindQuery(query string) *FindQuery {
+	return &FindQuery{
+		Query:  query,
+		Format: FindFormatTreeJSON,
+		client: c,
+	}
+}
+
+// Client returns client, used for requests
+func (q *FindQuery) Client() *Client {
+	if q.client == nil {
+		return DefaultClient
+	}
+	return q.client
+}
+
+func (q *FindQuery) SetQuery(query string) *FindQuery {
+	q.Query = query
+	return q
+}
+
+func (q *FindQuery) SetFrom(from string) *FindQuery {
+	q.From = from
+	return q
+}
+
+func (q *FindQuery) SetUntil(until string) *FindQuery {
+	q.Until = until
+	return q
+}
+
+// SetFromTime sets from as unix timestamp
+func (q *FindQuery) SetFromTime(from time.Time) *FindQuery {
+	q.From = FormatATTime(from)
+	return q
+}
+
+// SetUntilTime sets until as unix timestamp
+func (q *FindQuery) SetUntilTime(until time.Time) *FindQuery {
+	q.Until = FormatATTime(until)
+	return q
+}
+
+func (q *FindQuery) SetWildcards(wildcards bool) *FindQuery {
+	q.Wildcards = wildcards
+	return q
+}
+
+func (q *FindQuery) SetFormat(format FindFormat) *FindQuery {
+	q.Format = format
+	return q
+}
+
+// URL returns query url
+func (q *FindQuery) URL() (*url.URL, error) {
+	u, err := url.Parse(q.Client().Base() + "/metrics/find")
+	if err != nil {
+		return nil, err
+	}
+	v := url.Values{}
+
+	if q.Format == "" {
+		v.Set("format", string(FindFormatTreeJSON))
+	} else {
+		v.Set("format", string(q.Format))
+	}
+
+	v.Set("query", q.Query)
+
+	if q.From != "" {
+		v.Set("from", q.From)
+	}
+
+	if q.Until != "" {
+		v.Set("until", q.Until)
+	}
+
+	if q.Wildcards {
+		v.Set("wildcards", "1")
+	}
+
+	u.RawQuery = v.Encode()
+
+	return u, nil
+}
+
+// Request do `/metrics/find` request and returns found nodes
+func (q *FindQuery) Request(ctx context.Context) (FindNodes, error) {
+	var nodes FindNodes
+	if err := q.Client().request(ctx, q, &nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// Unmarshal implements Response interface
+func (n *FindNodes) Unmarshal(data []byte) error {
+	nodes, err := unmarshallFindNodes(data)
+	if err != nil {
+		return err
+	}
+	*n = nodes
+	return nil
+}
@@ -0,0 +1,77 @@
+package graphiteapi
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestFindQuery_URL(t *testing.T) {
+	q := NewClient("http://domain.tld/path").NewFindQuery("TEST.*").SetFrom("-1d").SetWildcards(true)
+	shouldUrl := "http://domain.tld/path/metrics/find?format=treejson&from=-1d&query=TEST.%2A&wildcards=1"
+	url, err := q.URL()
+	if err != nil {
+		t.Fatalf("Resulting URL is nil, error is '%v'", err)
+	}
+	gotUrl := url.String()
+	if shouldUrl != gotUrl {
+		t.Errorf("Resulting URL is %v, \n but should be %v", gotUrl, shouldUrl)
+	}
+}
+
+var findTestCases = []struct {
+	Query         string
+	Format        FindFormat
+	ExpectedQuery string
+	Result        string
+	Nodes         FindNodes
+}{
+	{
+		Query:         "a.*",
+		ExpectedQuery: "format=treejson&query=a.*",
+		Result: `[{"leaf": 0, "context": {}, "text": "b", "expandable": 1, "id": "a.b", "allowChildren": 1},` +
+			`{"leaf": 1, "context": {}, "text": "c", "expandable": 0, "id": "a.c", "allowChildren": 0}]`,
+		Nodes: FindNodes{
+			{ID: "a.b", Text: "b", Leaf: false, Expandable: true, AllowChildren: true},
+			{ID: "a.c", Text: "c", Leaf: true, Expandable: false, AllowChildren: false},
+		},
+	},
+	{
+		Query:         "a.*",
+		Format:        FindFormatJSON,
+		ExpectedQuery: "format=json&query=a.*",
+		Result:        `[{"path": "a.b", "is_leaf": false, "intervals": []}, {"path": "a.c", "is_leaf": true, "intervals": []}]`,
+		Nodes: FindNodes{
+			{ID: "a.b", Text: "b", Leaf: false, Expandable: true, AllowChildren: true},
+			{ID: "a.c", Text: "c", Leaf: true, Expandable: false, AllowChildren: false},
+		},
+	},
+	{
+		Query:         "b.*",
+		ExpectedQuery: "format=treejson&query=b.*",
+		Result:        "[]",
+		Nodes:         FindNodes{},
+	},
+}
+
+func TestFindQuery_Request(t *testing.T) {
+	for i, tt := range findTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			ts := makeJSONServer(t, "/metrics/find", tt.ExpectedQuery, tt.Result)
+			defer ts.Close()
+
+			q := NewClient("http://" + ts.Listener.Addr().String()).NewFindQuery(tt.Query)
+			if tt.Format != "" {
+				q.SetFormat(tt.Format)
+			}
+			nodes, err := q.Request(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(nodes, tt.Nodes) {
+				t.Errorf("- %+v\n+ %+v", tt.Nodes, nodes)
+			}
+		})
+	}
+}
@@ -4,6 +4,10 @@ go 1.16
 
 require (
 	github.com/buger/jsonparser v1.1.1
+	github.com/klauspost/compress v1.15.9
 	github.com/kr/pretty v0.2.0
 	github.com/spf13/cobra v1.3.0
+	go.opentelemetry.io/otel v1.7.0
+	go.opentelemetry.io/otel/sdk v1.7.0
+	go.opentelemetry.io/otel/trace v1.7.0
 )
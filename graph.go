@@ -0,0 +1,285 @@
+package graphiteapi
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewGraphQuery returns a GraphQuery instance, bound to client
+func (c *Client) NewGraphQuery(from, until string, targets []string) *GraphQuery {
+	return &GraphQuery{
+		Targets: targets,
+		From:    from,
+		Until:   until,
+		Format:  GraphFormatPNG,
+		client:  c,
+	}
+}
+
+// Client returns client, used for requests
+func (q *GraphQuery) Client() *Client {
+	if q.client == nil {
+		return DefaultClient
+	}
+	return q.client
+}
+
+func (q *GraphQuery) SetFrom(from string) *GraphQuery {
+	q.From = from
+	return q
+}
+
+func (q *GraphQuery) SetUntil(until string) *GraphQuery {
+	q.Until = until
+	return q
+}
+
+// SetFromTime sets from as unix timestamp
+func (q *GraphQuery) SetFromTime(from time.Time) *GraphQuery {
+	q.From = FormatATTime(from)
+	return q
+}
+
+// SetUntilTime sets until as unix timestamp
+func (q *GraphQuery) SetUntilTime(until time.Time) *GraphQuery {
+	q.Until = FormatATTime(until)
+	return q
+}
+
+func (q *GraphQuery) SetTz(tz string) *GraphQuery {
+	q.Tz = tz
+	return q
+}
+
+func (q *GraphQuery) SetTargets(targets []string) *GraphQuery {
+	q.Targets = targets
+	return q
+}
+
+func (q *GraphQuery) AddTarget(target string) *GraphQuery {
+	q.Targets = append(q.Targets, target)
+	return q
+}
+
+func (q *GraphQuery) SetFormat(format GraphFormat) *GraphQuery {
+	q.Format = format
+	return q
+}
+
+func (q *GraphQuery) SetSize(width, height int) *GraphQuery {
+	q.Width = width
+	q.Height = height
+	return q
+}
+
+func (q *GraphQuery) SetTitle(title string) *GraphQuery {
+	q.Title = title
+	return q
+}
+
+func (q *GraphQuery) SetVTitle(vtitle string) *GraphQuery {
+	q.VTitle = vtitle
+	return q
+}
+
+func (q *GraphQuery) SetColorList(colors []string) *GraphQuery {
+	q.ColorList = colors
+	return q
+}
+
+func (q *GraphQuery) SetAreaMode(areaMode GraphAreaMode) *GraphQuery {
+	q.AreaMode = areaMode
+	return q
+}
+
+func (q *GraphQuery) SetLineMode(lineMode GraphLineMode) *GraphQuery {
+	q.LineMode = lineMode
+	return q
+}
+
+func (q *GraphQuery) SetYMin(yMin float64) *GraphQuery {
+	q.YMin = &yMin
+	return q
+}
+
+func (q *GraphQuery) SetYMax(yMax float64) *GraphQuery {
+	q.YMax = &yMax
+	return q
+}
+
+func (q *GraphQuery) SetHideLegend(hideLegend bool) *GraphQuery {
+	q.HideLegend = &hideLegend
+	return q
+}
+
+func (q *GraphQuery) SetTemplate(template string) *GraphQuery {
+	q.Template = template
+	return q
+}
+
+func (q *GraphQuery) SetBgColor(color string) *GraphQuery {
+	q.BgColor = color
+	return q
+}
+
+func (q *GraphQuery) SetFgColor(color string) *GraphQuery {
+	q.FgColor = color
+	return q
+}
+
+// SetParam sets additional render parameter
+func (q *GraphQuery) SetParam(key, value string) *GraphQuery {
+	if q.Params == nil {
+		q.Params = make(url.Values)
+	}
+	q.Params.Set(key, value)
+	return q
+}
+
+func (q *GraphQuery) format() GraphFormat {
+	if q.Format == "" {
+		return GraphFormatPNG
+	}
+	return q.Format
+}
+
+// contentType returns expected response content type for format
+func (f GraphFormat) contentType() string {
+	switch f {
+	case GraphFormatSVG:
+		return "image/svg+xml"
+	default:
+		return "image/" + string(f)
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// URL returns query url
+func (q *GraphQuery) URL() (*url.URL, error) {
+	u, err := url.Parse(q.Client().Base() + "/render/")
+	if err != nil {
+		return nil, err
+	}
+	v := url.Values{}
+	for key, values := range q.Params {
+		v[key] = append([]string(nil), values...)
+	}
+
+	v.Set("format", string(q.format()))
+
+	for _, target := range q.Targets {
+		v.Add("target", target)
+	}
+
+	if q.From != "" {
+		v.Set("from", q.From)
+	}
+	if q.Until != "" {
+		v.Set("until", q.Until)
+	}
+	if q.Tz != "" {
+		v.Set("tz", q.Tz)
+	}
+	if q.Width > 0 {
+		v.Set("width", strconv.Itoa(q.Width))
+	}
+	if q.Height > 0 {
+		v.Set("height", strconv.Itoa(q.Height))
+	}
+	if q.Title != "" {
+		v.Set("title", q.Title)
+	}
+	if q.VTitle != "" {
+		v.Set("vtitle", q.VTitle)
+	}
+	if q.VTitleRight != "" {
+		v.Set("vtitleRight", q.VTitleRight)
+	}
+	if len(q.ColorList) > 0 {
+		v.Set("colorList", strings.Join(q.ColorList, ","))
+	}
+	if q.AreaMode != "" {
+		v.Set("areaMode", string(q.AreaMode))
+	}
+	if q.LineMode != "" {
+		v.Set("lineMode", string(q.LineMode))
+	}
+	if q.LineWidth > 0 {
+		v.Set("lineWidth", formatFloat(q.LineWidth))
+	}
+	if q.YMin != nil {
+		v.Set("yMin", formatFloat(*q.YMin))
+	}
+	if q.YMax != nil {
+		v.Set("yMax", formatFloat(*q.YMax))
+	}
+	if q.HideLegend != nil {
+		v.Set("hideLegend", strconv.FormatBool(*q.HideLegend))
+	}
+	if q.HideAxes {
+		v.Set("hideAxes", "true")
+	}
+	if q.HideGrid {
+		v.Set("hideGrid", "true")
+	}
+	if q.GraphOnly {
+		v.Set("graphOnly", "true")
+	}
+	if q.Template != "" {
+		v.Set("template", q.Template)
+	}
+	if q.BgColor != "" {
+		v.Set("bgcolor", q.BgColor)
+	}
+	if q.FgColor != "" {
+		v.Set("fgcolor", q.FgColor)
+	}
+	if q.FontSize > 0 {
+		v.Set("fontSize", formatFloat(q.FontSize))
+	}
+
+	u.RawQuery = v.Encode()
+
+	return u, nil
+}
+
+// Request do `/render/` request and returns graph image
+func (q *GraphQuery) Request(ctx context.Context) (image *GraphImage, err error) {
+	url, err := q.URL()
+	if err != nil {
+		return nil, err
+	}
+
+	client := q.Client()
+	req, err := client.httpNewRequest("GET", url.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, span := client.startSpan(ctx, req.URL.Path,
+		attrTargets.Int(len(q.Targets)),
+		attrFrom.String(q.From),
+		attrUntil.String(q.Until),
+		attrFormat.String(string(q.format())),
+	)
+	defer func() { endSpan(span, err) }()
+
+	contentType := q.format().contentType()
+	data, header, err := client.httpDoHeader(ctx, req, contentType)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attrResponseSize.Int(len(data)))
+
+	// response content type may have parameters, like charset
+	if ct := header.Get("Content-Type"); ct != "" {
+		contentType = ct
+	}
+	return &GraphImage{ContentType: contentType, Data: data}, nil
+}
@@ -0,0 +1,71 @@
+package graphiteapi
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestGraphQuery_URL(t *testing.T) {
+	q := NewClient("http://domain.tld").NewGraphQuery("-1h", "now", []string{"a.b"}).
+		SetSize(800, 600).SetTitle("Test graph").SetColorList([]string{"red", "#00ff00"}).
+		SetAreaMode(GraphAreaModeStacked).SetLineMode(GraphLineModeStaircase).
+		SetYMin(0).SetYMax(1.5).SetHideLegend(false).SetTemplate("solarized-dark").SetBgColor("black").
+		SetParam("uniqueLegend", "true")
+	u, err := q.URL()
+	if err != nil {
+		t.Fatalf("Resulting URL is nil, error is '%v'", err)
+	}
+	wantQuery := url.Values{
+		"format":       {"png"},
+		"target":       {"a.b"},
+		"from":         {"-1h"},
+		"until":        {"now"},
+		"width":        {"800"},
+		"height":       {"600"},
+		"title":        {"Test graph"},
+		"colorList":    {"red,#00ff00"},
+		"areaMode":     {"stacked"},
+		"lineMode":     {"staircase"},
+		"yMin":         {"0"},
+		"yMax":         {"1.5"},
+		"hideLegend":   {"false"},
+		"template":     {"solarized-dark"},
+		"bgcolor":      {"black"},
+		"uniqueLegend": {"true"},
+	}
+	if !reflect.DeepEqual(u.Query(), wantQuery) {
+		t.Errorf("Expected query is %+v but %+v got", wantQuery, u.Query())
+	}
+}
+
+func TestGraphQuery_Request(t *testing.T) {
+	svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/render/" {
+			t.Errorf("Path should be `/render/` but %s found", r.URL.Path)
+		}
+		if format := r.URL.Query().Get("format"); format != "svg" {
+			t.Errorf("Format should be svg but %s found", format)
+		}
+		w.Header().Set("Content-type", "image/svg+xml; charset=utf-8")
+		w.Write(svg)
+	}))
+	defer ts.Close()
+
+	q := NewClient("http://"+ts.Listener.Addr().String()).NewGraphQuery("-1h", "", []string{"a.b"}).SetFormat(GraphFormatSVG)
+	image, err := q.Request(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.ContentType != "image/svg+xml; charset=utf-8" {
+		t.Errorf("Content type should be image/svg+xml; charset=utf-8 but %s found", image.ContentType)
+	}
+	if !bytes.Equal(image.Data, svg) {
+		t.Errorf("- %s\n+ %s", string(svg), string(image.Data))
+	}
+}
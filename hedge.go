@@ -0,0 +1,197 @@
+package graphiteapi
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultHedgeWindow is a default count of latency samples for hedge delay percentile
+	DefaultHedgeWindow = 1000
+	// hedgeMinSamples is a minimal count of latency samples for use percentile instead of fixed delay
+	hedgeMinSamples = 20
+	// hedgeRecalcEvery is a count of new samples before percentile recalculation
+	hedgeRecalcEvery = 16
+)
+
+// HedgePolicy describes hedged requests: if backend has not answered within delay,
+// duplicate request is sent to other backend and the first answer is used.
+// Only idempotent requests (GET and render POST) are hedged and only with multiple backends.
+type HedgePolicy struct {
+	Delay      time.Duration // hedge delay, used if Percentile is not set or not enough latency samples collected
+	Percentile float64       // latency percentile (0 - 100) of recent requests for hedge delay, 0 for fixed Delay
+	Window     int           // count of recent latency samples, DefaultHedgeWindow if not set
+}
+
+// HedgeStats is a hedged requests counters
+type HedgeStats struct {
+	Requests uint64 // requests, which can be hedged
+	Fired    uint64 // hedged requests sent
+	Won      uint64 // hedged requests answered first
+}
+
+// hedger calculates hedge delay from latency samples and counts hedged requests
+type hedger struct {
+	policy HedgePolicy
+
+	mu      sync.Mutex
+	samples []time.Duration // ring buffer of latencies
+	pos     int
+	added   int           // samples added after last percentile calculation
+	delay   time.Duration // calculated percentile delay, 0 if not calculated
+
+	requests uint64
+	fired    uint64
+	won      uint64
+}
+
+func newHedger(policy HedgePolicy) *hedger {
+	if policy.Window <= 0 {
+		policy.Window = DefaultHedgeWindow
+	}
+	return &hedger{
+		policy:  policy,
+		samples: make([]time.Duration, 0, policy.Window),
+	}
+}
+
+// observe adds latency sample of successful request
+func (h *hedger) observe(d time.Duration) {
+	if h.policy.Percentile <= 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.samples) < h.policy.Window {
+		h.samples = append(h.samples, d)
+	} else {
+		h.samples[h.pos] = d
+		h.pos = (h.pos + 1) % h.policy.Window
+	}
+	h.added++
+	if len(h.samples) >= hedgeMinSamples && (h.delay == 0 || h.added >= hedgeRecalcEvery) {
+		sorted := make([]time.Duration, len(h.samples))
+		copy(sorted, h.samples)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		n := int(float64(len(sorted)-1) * h.policy.Percentile / 100)
+		if n >= len(sorted) {
+			n = len(sorted) - 1
+		}
+		h.delay = sorted[n]
+		h.added = 0
+	}
+}
+
+// hedgeDelay returns delay before hedged request
+func (h *hedger) hedgeDelay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.delay > 0 {
+		return h.delay
+	}
+	return h.policy.Delay
+}
+
+func (h *hedger) stats() HedgeStats {
+	return HedgeStats{
+		Requests: atomic.LoadUint64(&h.requests),
+		Fired:    atomic.LoadUint64(&h.fired),
+		Won:      atomic.LoadUint64(&h.won),
+	}
+}
+
+// hedgedAttempt does request attempt on backend and hedged request on other backend, if the first is not answered within hedge delay.
+// Returns the first successful result (or the last failed). The slower request is canceled and not tracked in backend health.
+func hedgedAttempt(ctx context.Context, h *hedger, opts *attemptOptions, req *http.Request,
+	pool *backendPool, tried *[]*backend, breakers *circuitBreakers) (attemptResult, error) {
+
+	atomic.AddUint64(&h.requests, 1)
+
+	type hedgedResult struct {
+		attemptResult
+		n int // index of attempt cancel func
+	}
+	var (
+		results = make(chan hedgedResult, 2)
+		cancels []context.CancelFunc
+	)
+	start := func(r *http.Request, b *backend, base string, hedged bool) {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		n := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			res := doAttempt(attemptCtx, opts, r)
+			res.backend = b
+			res.base = base
+			res.hedged = hedged
+			results <- hedgedResult{attemptResult: res, n: n}
+		}()
+	}
+	// finish cancels requests (except keep) and closes streamed bodies of running requests
+	finish := func(running, keep int) {
+		for i, cancel := range cancels {
+			if i != keep {
+				cancel()
+			}
+		}
+		if running > 0 {
+			go func() {
+				for i := 0; i < running; i++ {
+					res := <-results
+					if res.body != nil {
+						res.body.Close()
+					}
+					putBuffer(res.buf)
+				}
+			}()
+		}
+	}
+
+	r, first, base, err := prepareAttempt(ctx, req, false, pool, tried, breakers)
+	if err != nil {
+		return attemptResult{}, err
+	}
+	start(r, first, base, false)
+	running := 1
+
+	timer := time.NewTimer(h.hedgeDelay())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			if first == nil || running == 0 {
+				continue
+			}
+			// the first request is too slow, duplicate it to other backend
+			r, b, base, err := prepareAttempt(ctx, req, false, pool, tried, breakers)
+			if err != nil || b == nil || b == first {
+				continue
+			}
+			atomic.AddUint64(&h.fired, 1)
+			start(r, b, base, true)
+			running++
+		case res := <-results:
+			running--
+			reportAttempt(ctx, pool, breakers, &res.attemptResult)
+			if res.err == nil || running == 0 {
+				if res.err == nil && res.hedged {
+					atomic.AddUint64(&h.won, 1)
+				}
+				keep := -1
+				if res.body != nil {
+					// winner context is canceled on body close
+					keep = res.n
+					res.body = withDone(res.body, cancels[keep])
+				}
+				finish(running, keep)
+				return res.attemptResult, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package graphiteapi
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestClient_Hedging(t *testing.T) {
+	tests := []struct {
+		name       string
+		delay      []time.Duration
+		policy     HedgePolicy
+		wantFired  uint64
+		wantWon    uint64
+		wantHedged bool
+	}{
+		{
+			name:       "slow primary",
+			delay:      []time.Duration{time.Second, 0},
+			policy:     HedgePolicy{Delay: 50 * time.Millisecond},
+			wantFired:  1,
+			wantWon:    1,
+			wantHedged: true,
+		},
+		{
+			name:   "fast primary",
+			delay:  []time.Duration{0, 0},
+			policy: HedgePolicy{Delay: time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := newTestBackends(t, len(tt.delay), tt.delay, nil)
+			defer closeTestBackends(backends)
+
+			client := NewClient("").SetBackends(testBackendsBases(backends), BalancePriority).SetHedging(&tt.policy)
+
+			var info ResponseInfo
+			ctx := WithResponseInfo(context.Background(), &info)
+			start := time.Now()
+			if _, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Request(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantHedged && time.Since(start) > 500*time.Millisecond {
+				t.Errorf("hedged request is too slow: %s", time.Since(start))
+			}
+			if info.Hedged != tt.wantHedged {
+				t.Errorf("ResponseInfo.Hedged = %v, want %v", info.Hedged, tt.wantHedged)
+			}
+			want := HedgeStats{Requests: 1, Fired: tt.wantFired, Won: tt.wantWon}
+			if stats := client.HedgeStats(); stats != want {
+				t.Errorf("HedgeStats() = %+v, want %+v", stats, want)
+			}
+		})
+	}
+}
+
+func TestHedger_Percentile(t *testing.T) {
+	h := newHedger(HedgePolicy{Delay: time.Second, Percentile: 90, Window: 100})
+	for i := 1; i < hedgeMinSamples; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+	if d := h.hedgeDelay(); d != time.Second {
+		t.Errorf("hedgeDelay() without enough samples = %s, want %s", d, time.Second)
+	}
+	for i := hedgeMinSamples; i <= 100; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+	if d := h.hedgeDelay(); d < 80*time.Millisecond || d > 100*time.Millisecond {
+		t.Errorf("hedgeDelay() = %s, want about 90ms", d)
+	}
+}
+
+func TestClient_HedgingDisabledForSingleBackend(t *testing.T) {
+	backends := newTestBackends(t, 1, nil, nil)
+	defer closeTestBackends(backends)
+
+	client := NewClient(backends[0].base).SetHedging(&HedgePolicy{Delay: time.Millisecond})
+	if _, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Request(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if stats := client.HedgeStats(); stats != (HedgeStats{}) {
+		t.Errorf("HedgeStats() = %+v, want zero", stats)
+	}
+}
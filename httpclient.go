@@ -1,96 +1,492 @@
 package graphiteapi
 
 import (
+	"bytes"
 	"context"
-	"fmt"
+	"errors"
 	"io"
 	"io/ioutil"
-	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
-)
 
-// httpClient is used everywhere internally, here we initialize a default http client,
-// library users can call graphiteapi.UseHTTPClient() to set a customized http client.
-var httpClient *http.Client = &http.Client{
-	Timeout: 5 * time.Second,
-	Transport: &http.Transport{
-		Dial: (&net.Dialer{
-			Timeout: 1 * time.Second,
-		}).Dial,
-		MaxIdleConnsPerHost: 5,
-	},
-}
-
-var (
-	userAgent     string              = "graphite-api-client/0.1"
-	customHeaders map[string][]string = make(map[string][]string) // not thread safe, init on startup
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// SetHTTPClient sets the http client used to make requests
+// SetHTTPClient sets the http client used to make requests by DefaultClient.
+// DefaultClient request timeout is disabled, so client.Timeout is used.
 func SetHTTPClient(client *http.Client) {
-	httpClient = client
+	DefaultClient.SetHTTPClient(client).SetTimeout(0)
 }
 
-// AddCustomHeader adds a custom header on all requests
+// AddCustomHeader adds a custom header on all requests, made by DefaultClient
 func AddCustomHeader(key, value string) {
-	if key == "User-Agent" {
-		SetUserAgent(value)
-		return
-	}
-
-	if values, ok := customHeaders[key]; ok {
-		values = append(values, value)
-		customHeaders[key] = values
-	} else {
-		values = []string{value}
-		customHeaders[key] = values
-	}
+	DefaultClient.AddHeader(key, value)
 }
 
-// SetUserAgent sets a custom user agent
+// SetUserAgent sets a custom user agent for DefaultClient
 func SetUserAgent(ua string) {
-	userAgent = ua
+	DefaultClient.SetUserAgent(ua)
 }
 
-// httpNewRequest wraps http.NewRequest(), and set custom headers
-func httpNewRequest(method string, url string, body io.Reader) (*http.Request, error) {
+// httpNewRequest wraps http.NewRequest(), and set custom headers (authenticator is applied for each attempt)
+func (c *Client) httpNewRequest(method string, url string, body io.Reader) (*http.Request, error) {
 	if req, err := http.NewRequest(method, url, body); err != nil {
 		return req, err
 	} else {
-		req.Header.Set("User-Agent", userAgent)
-		for key := range customHeaders {
-			values := customHeaders[key]
+		c.mu.RLock()
+		req.Header.Set("User-Agent", c.userAgent)
+		for key, values := range c.headers {
 			for _, value := range values {
 				req.Header.Add(key, value)
 			}
 		}
+		if req.Header.Get("Accept-Encoding") == "" {
+			// net/http transparent decompression is disabled by explicit Accept-Encoding, so responses are decompressed in httpAttempt
+			if c.compression {
+				req.Header.Set("Accept-Encoding", acceptEncoding)
+			} else {
+				req.Header.Set("Accept-Encoding", acceptIdentity)
+			}
+		}
+		c.mu.RUnlock()
 		return req, nil
 	}
 }
 
-// httpDo wraps http.Client.Do(), fetches response and unmarshals into r
-func httpDo(ctx context.Context, req *http.Request) ([]byte, error) {
+// attemptResult is a result of single request attempt
+type attemptResult struct {
+	req        *http.Request
+	backend    *backend      // nil, if request is not balanced
+	base       string        // base url of backend
+	hedged     bool          // result of hedged request
+	body       io.ReadCloser // unread response body for stream
+	buf        *bytes.Buffer // pooled buffer with response body (data), must be returned with putBuffer
+	notSent    bool          // request was not sent (limits wait or authentication failed)
+	data       []byte
+	statusCode int
+	header     http.Header
+	err        error
+	duration   time.Duration
+}
+
+// prepareAttempt clones request for attempt (body is reset, if fresh is false) and chooses backend from pool (if set).
+// Backends with open circuit are skipped, ErrCircuitOpen is returned, if no backend is allowed.
+func prepareAttempt(ctx context.Context, req *http.Request, fresh bool, pool *backendPool, tried *[]*backend,
+	breakers *circuitBreakers) (*http.Request, *backend, string, error) {
+
+	attemptReq := req
+	if !fresh {
+		attemptReq = req.Clone(ctx)
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, nil, "", err
+			}
+			attemptReq.Body = body
+		}
+	}
+
+	base := req.URL.Scheme + "://" + req.URL.Host
+	if pool == nil {
+		if breakers != nil {
+			if err := breakers.allow(req.URL.Host); err != nil {
+				return nil, nil, "", err
+			}
+		}
+		return attemptReq, nil, base, nil
+	}
+
+	if len(*tried) == len(pool.backends) {
+		*tried = (*tried)[:0]
+	}
+	b := pool.pick(*tried)
+	for {
+		if b.urlErr != nil {
+			return nil, nil, "", b.urlErr
+		}
+		if breakers == nil {
+			break
+		}
+		err := breakers.allow(b.url.Host)
+		if err == nil {
+			break
+		}
+		*tried = append(*tried, b)
+		if len(*tried) >= len(pool.backends) {
+			return nil, nil, "", err
+		}
+		b = pool.pick(*tried)
+	}
+	*tried = append(*tried, b)
+	u := rewriteURL(req.URL, pool.backends[0].url, b.url)
+	if u == nil {
+		// request to other server (base url is overridden in query)
+		if breakers != nil {
+			if err := breakers.allow(req.URL.Host); err != nil {
+				return nil, nil, "", err
+			}
+		}
+		return attemptReq, nil, base, nil
+	}
+	if attemptReq == req {
+		attemptReq = req.Clone(ctx)
+	}
+	attemptReq.URL = u
+	attemptReq.Host = ""
+	return attemptReq, b, b.base, nil
+}
+
+// reportAttempt updates backend health and circuit breaker after attempt
+func reportAttempt(ctx context.Context, pool *backendPool, breakers *circuitBreakers, res *attemptResult) {
+	if res.notSent {
+		return
+	}
+	failed := isBackendFailure(ctx, res.statusCode, res.err)
+	if res.backend != nil {
+		pool.report(res.backend, res.duration, failed)
+	}
+	if breakers != nil && ctx.Err() == nil {
+		breakers.report(res.req.URL.Host, failed)
+	}
+}
+
+// attemptOptions are client settings for request attempts
+type attemptOptions struct {
+	doer         Doer          // http client, wrapped with middlewares
+	timeout      time.Duration // attempt timeout, 0 for no timeout
+	limiter      *limiter
+	contentTypes []string // expected response content types
+	stream       bool     // response body is returned unread (attemptResult.body)
+	pooled       bool     // response body is read into buffer from pool (attemptResult.buf)
+	auth         Authenticator
+	tracer       trace.Tracer
+	propagator   propagation.TextMapPropagator
+}
+
+// attemptBody is a streamed response body, done is called once on Close (cancels attempt context, releases limits)
+type attemptBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *attemptBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
+
+// withDone returns body, which calls done after Close (and previous done funcs)
+func withDone(body io.ReadCloser, done func()) io.ReadCloser {
+	return &attemptBody{ReadCloser: body, done: done}
+}
+
+// doAttempt does a single request attempt (after waiting for limits) and measures its duration (till response headers for stream)
+func doAttempt(ctx context.Context, opts *attemptOptions, req *http.Request) attemptResult {
+	res := attemptResult{req: req}
+	release, err := opts.limiter.acquire(ctx, req.URL.Host)
+	if err != nil {
+		res.err = err
+		res.notSent = true
+		return res
+	}
+
+	var (
+		cancel       context.CancelFunc
+		headersTimer *time.Timer
+	)
+	if opts.timeout > 0 && !opts.stream {
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+		if opts.timeout > 0 {
+			// stream body is read by caller at own pace, so timeout is applied till response headers
+			headersTimer = time.AfterFunc(opts.timeout, cancel)
+		}
+	}
+	done := func() {
+		cancel()
+		release()
+	}
+
+	ctx, span := startAttemptSpan(ctx, opts, req)
 	req = req.WithContext(ctx)
+	if opts.auth != nil {
+		if res.err = opts.auth.Authenticate(req); res.err != nil {
+			res.notSent = true
+			endAttemptSpan(span, &res)
+			done()
+			return res
+		}
+	}
 
-	var resp *http.Response
-	var body []byte
-	var err error
+	start := time.Now()
+	var body io.ReadCloser
+	body, res.statusCode, res.header, res.err = httpAttempt(opts.doer, req, opts.contentTypes)
+	if headersTimer != nil && !headersTimer.Stop() {
+		// attempt is cancelled by headers timeout
+		if body != nil {
+			body.Close()
+		}
+		res.statusCode = 0
+		res.err = &url.Error{Op: req.Method, URL: req.URL.Redacted(), Err: context.DeadlineExceeded}
+	}
+	if res.statusCode == http.StatusUnauthorized {
+		if a, ok := opts.auth.(interface{ Invalidate() }); ok {
+			// cached token is rejected
+			a.Invalidate()
+		}
+	}
+	if res.err == nil {
+		if opts.stream {
+			res.duration = time.Since(start)
+			result := res
+			res.body = withDone(body, func() {
+				endAttemptSpan(span, &result)
+				done()
+			})
+			return res
+		}
+		if opts.pooled {
+			res.buf = getBuffer()
+			if _, res.err = res.buf.ReadFrom(body); res.err != nil {
+				putBuffer(res.buf)
+				res.buf = nil
+			} else {
+				res.data = res.buf.Bytes()
+			}
+		} else {
+			res.data, res.err = ioutil.ReadAll(body)
+		}
+		body.Close()
+		if res.err != nil {
+			res.statusCode = 0
+		}
+	}
+	res.duration = time.Since(start)
+	endAttemptSpan(span, &res)
+	done()
+	return res
+}
 
-	if resp, err = httpClient.Do(req); err != nil {
-		return nil, err
+// isIdempotent checks, if request can be safely duplicated: GET, HEAD or marked with Idempotency-Key header (as in net/http)
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead:
+		return true
 	}
-	if body, err = ioutil.ReadAll(resp.Body); err != nil {
-		return nil, err
+	if _, ok := req.Header["Idempotency-Key"]; ok {
+		return true
 	}
-	if resp.StatusCode == 404 {
-		return nil, nil
-	} else if resp.StatusCode == 200 {
-		if resp.Header.Get("Content-type") == "application/json" {
-			return body, err
+	_, ok := req.Header["X-Idempotency-Key"]
+	return ok
+}
+
+// httpDo wraps http.Client.Do() (and client middlewares) with retries (if retry policy is set), balancing (if multiple backends are set)
+// and hedging (if hedge policy is set), fetches response body with expected content type
+func (c *Client) httpDo(ctx context.Context, req *http.Request, contentTypes ...string) ([]byte, error) {
+	res := c.do(ctx, req, contentTypes, attemptOptions{})
+	return res.data, res.err
+}
+
+// httpDoHeader is like httpDo, but also returns response headers
+func (c *Client) httpDoHeader(ctx context.Context, req *http.Request, contentTypes ...string) ([]byte, http.Header, error) {
+	res := c.do(ctx, req, contentTypes, attemptOptions{})
+	return res.data, res.header, res.err
+}
+
+// httpDoStream is like httpDo, but returns unread response body, which must be closed.
+// Request is retried (or hedged) only before response headers are received.
+func (c *Client) httpDoStream(ctx context.Context, req *http.Request, contentTypes ...string) (io.ReadCloser, error) {
+	res := c.do(ctx, req, contentTypes, attemptOptions{stream: true})
+	return res.body, res.err
+}
+
+// httpDoBuffer is like httpDo, but reads response body into buffer from pool, which must be returned with putBuffer
+func (c *Client) httpDoBuffer(ctx context.Context, req *http.Request, contentTypes ...string) (*bytes.Buffer, error) {
+	res := c.do(ctx, req, contentTypes, attemptOptions{pooled: true})
+	return res.buf, res.err
+}
+
+// do executes request with retries, balancing and hedging, returns result of the last attempt
+func (c *Client) do(ctx context.Context, req *http.Request, contentTypes []string, mode attemptOptions) attemptResult {
+	c.mu.RLock()
+	opts := &attemptOptions{
+		doer:         chainDoer(c.httpClient, c.middlewares),
+		timeout:      c.timeout,
+		limiter:      c.limiter,
+		contentTypes: contentTypes,
+		stream:       mode.stream,
+		pooled:       mode.pooled,
+	}
+	opts.auth = requestAuthenticator(req, c.auth)
+	opts.tracer = newTracer(c.tracerProvider)
+	opts.propagator = newPropagator(c.propagator)
+	retry := c.retry
+	pool := c.pool
+	hedge := c.hedge
+	breakers := c.breakers
+	c.mu.RUnlock()
+
+	idempotent := isIdempotent(req)
+	if pool != nil && retry == nil && len(pool.backends) > 1 {
+		// failover to other backends without backoff
+		retry = &RetryPolicy{MaxAttempts: len(pool.backends), RetryNetworkErrors: true}
+	}
+	if hedge != nil && (pool == nil || len(pool.backends) < 2 || !idempotent) {
+		// only idempotent requests can be hedged to other backend
+		hedge = nil
+	}
+	info := responseInfoFromContext(ctx)
+
+	// request body must be re-readable for retry
+	canRetry := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+
+	var (
+		tried []*backend
+		res   attemptResult
+	)
+	for attempt := 1; ; attempt++ {
+		if hedge != nil && hedge.hedgeDelay() > 0 {
+			hedged, err := hedgedAttempt(ctx, hedge, opts, req, pool, &tried, breakers)
+			if err != nil {
+				if attempt > 1 && errors.Is(err, ErrCircuitOpen) {
+					// no backends left for retry, return the last failure
+					return attemptResult{err: res.err}
+				}
+				return attemptResult{err: err}
+			}
+			res = hedged
+		} else {
+			attemptReq, b, base, err := prepareAttempt(ctx, req, attempt == 1, pool, &tried, breakers)
+			if err != nil {
+				if attempt > 1 && errors.Is(err, ErrCircuitOpen) {
+					// no backends left for retry, return the last failure
+					return attemptResult{err: res.err}
+				}
+				return attemptResult{err: err}
+			}
+			res = doAttempt(ctx, opts, attemptReq)
+			res.backend = b
+			res.base = base
+			reportAttempt(ctx, pool, breakers, &res)
+		}
+		if hedge != nil && res.err == nil {
+			hedge.observe(res.duration)
+		}
+
+		if info != nil {
+			info.Backend = res.base
+			info.Attempts = attempt
+			info.StatusCode = res.statusCode
+			info.Hedged = res.hedged
+		}
+
+		var (
+			backoff   time.Duration
+			retryable bool
+		)
+		if res.err != nil && canRetry {
+			backoff, retryable = retry.retryBackoff(ctx, attempt, idempotent, res.statusCode, res.header, res.err)
 		}
-		return nil, fmt.Errorf("request ended with status %d: %s", http.StatusInternalServerError, string(body))
+		if retry != nil && retry.OnAttempt != nil {
+			retry.OnAttempt(RetryAttempt{
+				Attempt:    attempt,
+				Request:    res.req,
+				Backend:    res.base,
+				StatusCode: res.statusCode,
+				Err:        res.err,
+				Duration:   res.duration,
+				Backoff:    backoff,
+			})
+		}
+		if !retryable {
+			return res
+		}
+		if e := sleepContext(ctx, backoff); e != nil {
+			return attemptResult{err: res.err}
+		}
+	}
+}
+
+// maxErrorReadSize limits read of unsuccessful response body
+const maxErrorReadSize = 64 * 1024
+
+// httpAttempt does a single request (through middleware chain), returns unread (and decompressed) response body, status code and headers.
+// APIError is returned for unsuccessful status code or unexpected content type.
+func httpAttempt(doer Doer, req *http.Request, contentTypes []string) (io.ReadCloser, int, http.Header, error) {
+	resp, err := doer.Do(req)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	reader, err := decompressBody(resp)
+	if err != nil {
+		resp.Body.Close()
+		return nil, resp.StatusCode, resp.Header, err
+	}
+	if resp.StatusCode == http.StatusOK && isContentType(resp.Header.Get("Content-Type"), contentTypes...) {
+		return reader, resp.StatusCode, resp.Header, nil
+	}
+
+	defer reader.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(reader, maxErrorReadSize))
+	if err != nil {
+		return nil, 0, resp.Header, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, resp.Header, newAPIError(req, resp, body, nil)
+	}
+	return nil, resp.StatusCode, resp.Header, newAPIError(req, resp, body, ErrContentType)
+}
+
+// request does GET request for query and unmarshals response into r
+func (c *Client) request(ctx context.Context, q urlQuery, r Response) error {
+	u, err := q.URL()
+	if err != nil {
+		return err
+	}
+
+	req, err := c.httpNewRequest("GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	return c.doRequest(ctx, req, r)
+}
+
+// requestForm does POST request with form values for query and unmarshals response into r
+func (c *Client) requestForm(ctx context.Context, q urlQuery, form url.Values, r Response) error {
+	u, err := q.URL()
+	if err != nil {
+		return err
+	}
+
+	req, err := c.httpNewRequest("POST", u.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return c.doRequest(ctx, req, r)
+}
+
+// doRequest does request (in traced span) and unmarshals json response into r
+func (c *Client) doRequest(ctx context.Context, req *http.Request, r Response) (err error) {
+	ctx, span := c.startSpan(ctx, req.URL.Path)
+	defer func() { endSpan(span, err) }()
+
+	data, err := c.httpDo(ctx, req, "application/json")
+	if err != nil {
+		return err
 	}
+	span.SetAttributes(attrResponseSize.Int(len(data)))
 
-	return nil, fmt.Errorf("request ended with status %d: %s", resp.StatusCode, string(body))
+	start := time.Now()
+	err = r.Unmarshal(data)
+	span.SetAttributes(decodeTime(time.Since(start)))
+	return err
 }
@@ -0,0 +1,184 @@
+package graphiteapi
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limits describes client-side limits for requests to graphite server.
+// Each attempt (including retries and hedged requests) is counted as request.
+type Limits struct {
+	RPS         float64 // requests per second (token bucket rate), 0 for unlimited
+	Burst       int     // token bucket size, 1 if not set
+	MaxInFlight int     // max concurrent requests, 0 for unlimited
+}
+
+// tokenBucket is a token bucket rate limiter
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64 // can be negative for reserved tokens
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes token and returns wait time before it can be used
+func (tb *tokenBucket) reserve() time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := time.Now()
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+	tb.tokens--
+	if tb.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
+
+// cancel returns reserved token (bucket may be already refilled by other reserve, so tokens are limited by burst)
+func (tb *tokenBucket) cancel() {
+	tb.mu.Lock()
+	tb.tokens++
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.mu.Unlock()
+}
+
+// wait waits for token or context done
+func (tb *tokenBucket) wait(ctx context.Context) error {
+	d := tb.reserve()
+	if d == 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		// token will not be available before deadline
+		tb.cancel()
+		return context.DeadlineExceeded
+	}
+	if err := sleepContext(ctx, d); err != nil {
+		tb.cancel()
+		return err
+	}
+	return nil
+}
+
+// limit is a rate and concurrency limit
+type limit struct {
+	bucket   *tokenBucket  // nil for unlimited rate
+	inflight chan struct{} // nil for unlimited concurrency
+}
+
+func newLimit(l Limits) *limit {
+	lim := &limit{}
+	if l.RPS > 0 {
+		lim.bucket = newTokenBucket(l.RPS, l.Burst)
+	}
+	if l.MaxInFlight > 0 {
+		lim.inflight = make(chan struct{}, l.MaxInFlight)
+	}
+	return lim
+}
+
+// acquire waits for rate limit and free slot for concurrent request, release must be called after request.
+// Returned refund func releases slot and returns token, if request will not be sent.
+func (lim *limit) acquire(ctx context.Context) (func(), error) {
+	if lim.inflight != nil {
+		select {
+		case lim.inflight <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if lim.bucket != nil {
+		if err := lim.bucket.wait(ctx); err != nil {
+			lim.release()
+			return nil, err
+		}
+	}
+	return func() {
+		if lim.bucket != nil {
+			lim.bucket.cancel()
+		}
+		lim.release()
+	}, nil
+}
+
+func (lim *limit) release() {
+	if lim.inflight != nil {
+		<-lim.inflight
+	}
+}
+
+// limiter applies client-wide and per backend host limits
+type limiter struct {
+	client *limit // nil, if not set
+
+	mu       sync.Mutex
+	backend  *Limits // per backend host limits, nil if not set
+	backends map[string]*limit
+}
+
+func (l *limiter) hostLimit(host string) *limit {
+	if l.backend == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lim, ok := l.backends[host]
+	if !ok {
+		lim = newLimit(*l.backend)
+		l.backends[host] = lim
+	}
+	return lim
+}
+
+// acquire waits for client-wide and backend host limits, returns release func
+func (l *limiter) acquire(ctx context.Context, host string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	var refundClient func()
+	if l.client != nil {
+		var err error
+		if refundClient, err = l.client.acquire(ctx); err != nil {
+			return nil, err
+		}
+	}
+	hostLim := l.hostLimit(host)
+	if hostLim != nil {
+		if _, err := hostLim.acquire(ctx); err != nil {
+			if refundClient != nil {
+				// request is not sent, so client-wide token is returned
+				refundClient()
+			}
+			return nil, err
+		}
+	}
+	return func() {
+		if hostLim != nil {
+			hostLim.release()
+		}
+		if l.client != nil {
+			l.client.release()
+		}
+	}, nil
+}
@@ -0,0 +1,178 @@
+package graphiteapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newConcurrencyServer(delay time.Duration, requests, maxInFlight *int32) *httptest.Server {
+	var inFlight int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(delay)
+		w.Header().Set("Content-type", "application/json")
+		w.Write([]byte("[]"))
+	}))
+}
+
+func TestClient_Limits(t *testing.T) {
+	tests := []struct {
+		name        string
+		limits      Limits
+		backend     bool // per backend limits
+		requests    int
+		delay       time.Duration
+		minDuration time.Duration
+		maxInFlight int32
+	}{
+		{
+			name:        "rate",
+			limits:      Limits{RPS: 20, Burst: 2},
+			requests:    6,
+			minDuration: 150 * time.Millisecond, // 4 requests after burst
+			maxInFlight: 6,
+		},
+		{
+			name:        "in flight",
+			limits:      Limits{MaxInFlight: 2},
+			requests:    6,
+			delay:       20 * time.Millisecond,
+			minDuration: 60 * time.Millisecond,
+			maxInFlight: 2,
+		},
+		{
+			name:        "backend in flight",
+			limits:      Limits{MaxInFlight: 1},
+			backend:     true,
+			requests:    4,
+			delay:       20 * time.Millisecond,
+			minDuration: 80 * time.Millisecond,
+			maxInFlight: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests, maxInFlight int32
+			ts := newConcurrencyServer(tt.delay, &requests, &maxInFlight)
+			defer ts.Close()
+
+			client := NewClient("http://" + ts.Listener.Addr().String())
+			if tt.backend {
+				client.SetBackendLimits(&tt.limits)
+			} else {
+				client.SetLimits(&tt.limits)
+			}
+
+			start := time.Now()
+			var wg sync.WaitGroup
+			for i := 0; i < tt.requests; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Request(context.Background()); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if d := time.Since(start); d < tt.minDuration {
+				t.Errorf("requests done in %s, want at least %s", d, tt.minDuration)
+			}
+			if requests != int32(tt.requests) {
+				t.Errorf("server got %d requests, want %d", requests, tt.requests)
+			}
+			if maxInFlight > tt.maxInFlight {
+				t.Errorf("server got %d concurrent requests, want not more than %d", maxInFlight, tt.maxInFlight)
+			}
+		})
+	}
+}
+
+func TestClient_LimitsContext(t *testing.T) {
+	var requests, maxInFlight int32
+	ts := newConcurrencyServer(0, &requests, &maxInFlight)
+	defer ts.Close()
+
+	client := NewClient("http://" + ts.Listener.Addr().String()).SetLimits(&Limits{RPS: 1})
+	q := client.NewRenderQuery("", "", []string{"a.b"}, 0)
+	if _, err := q.Request(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := q.Request(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Request() error = %v, want context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Errorf("Request() failed after %s, want fail fast", d)
+	}
+	if requests != 1 {
+		t.Errorf("server got %d requests, want 1", requests)
+	}
+}
+
+func TestLimiter_RefundClientToken(t *testing.T) {
+	l := &limiter{
+		client:   newLimit(Limits{RPS: 0.001, Burst: 2}),
+		backend:  &Limits{MaxInFlight: 1},
+		backends: make(map[string]*limit),
+	}
+	release, err := l.acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// backend slot is busy, client token must be returned
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err = l.acquire(ctx, "a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	release()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	release, err = l.acquire(ctx, "b")
+	if err != nil {
+		t.Fatalf("acquire() error = %v, client token is not returned", err)
+	}
+	release()
+}
+
+func TestTokenBucket_CancelBurst(t *testing.T) {
+	tb := newTokenBucket(10, 2)
+	tb.reserve()
+	tb.reserve()
+
+	// bucket is refilled before reserved tokens are returned
+	tb.mu.Lock()
+	tb.last = tb.last.Add(-time.Second)
+	tb.mu.Unlock()
+	tb.reserve()
+	for i := 0; i < 3; i++ {
+		tb.cancel()
+	}
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if tb.tokens > tb.burst {
+		t.Errorf("tokens = %v, want not more than burst %v", tb.tokens, tb.burst)
+	}
+}
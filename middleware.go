@@ -0,0 +1,99 @@
+package graphiteapi
+
+import (
+	"net/http"
+	"time"
+)
+
+// Doer executes a single http request (like http.Client)
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// DoerFunc is an adapter to use function as Doer
+type DoerFunc func(req *http.Request) (*http.Response, error)
+
+// Do implements Doer interface
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps Doer, it's called for each request attempt (after balancing and authentication).
+// Middleware must not read response body and must be safe for concurrent use.
+//
+//	client.Use(func(next Doer) Doer {
+//		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+//			req.Header.Set("X-Request-Id", newRequestID())
+//			return next.Do(req)
+//		})
+//	})
+type Middleware func(next Doer) Doer
+
+// chainDoer wraps doer with middlewares, the first middleware is the outermost
+func chainDoer(doer Doer, middlewares []Middleware) Doer {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		doer = middlewares[i](doer)
+	}
+	return doer
+}
+
+// Use appends middlewares to client middleware chain (applied in order, the first one is the outermost)
+func (c *Client) Use(middlewares ...Middleware) *Client {
+	c.mu.Lock()
+	// copy, so chain, used by running requests, is not changed
+	mws := make([]Middleware, 0, len(c.middlewares)+len(middlewares))
+	c.middlewares = append(append(mws, c.middlewares...), middlewares...)
+	c.mu.Unlock()
+	return c
+}
+
+// SetMiddlewares replaces client middleware chain, nil removes all middlewares
+func (c *Client) SetMiddlewares(middlewares ...Middleware) *Client {
+	c.mu.Lock()
+	c.middlewares = append([]Middleware(nil), middlewares...)
+	c.mu.Unlock()
+	return c
+}
+
+// HeadersMiddleware returns middleware, which sets headers for each request (overrides client headers)
+func HeadersMiddleware(headers http.Header) Middleware {
+	headers = headers.Clone()
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			for k, v := range headers {
+				req.Header[k] = v
+			}
+			return next.Do(req)
+		})
+	}
+}
+
+// TimingMiddleware returns middleware, which calls fn after each request with duration till response headers
+// (statusCode is 0 on error)
+func TimingMiddleware(fn func(req *http.Request, statusCode int, err error, duration time.Duration)) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.Do(req)
+			var statusCode int
+			if resp != nil {
+				statusCode = resp.StatusCode
+			}
+			fn(req, statusCode, err, time.Since(start))
+			return resp, err
+		})
+	}
+}
+
+// LoggingMiddleware returns middleware, which logs each request with logf (like log.Printf):
+// method, url (without password), status code (or error) and duration till response headers
+func LoggingMiddleware(logf func(format string, args ...interface{})) Middleware {
+	return TimingMiddleware(func(req *http.Request, statusCode int, err error, duration time.Duration) {
+		if err != nil {
+			logf("graphite api: %s %s: %v (%s)", req.Method, req.URL.Redacted(), err, duration)
+		} else {
+			logf("graphite api: %s %s: %d (%s)", req.Method, req.URL.Redacted(), statusCode, duration)
+		}
+	})
+}
@@ -0,0 +1,140 @@
+package graphiteapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClient_Middlewares(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		headers []http.Header
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Clone())
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next Doer) Doer {
+			return DoerFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name+" before")
+				resp, err := next.Do(req)
+				order = append(order, name+" after")
+				return resp, err
+			})
+		}
+	}
+	var timings []string
+	client := NewClient("http://"+ts.Listener.Addr().String()).
+		SetAuthenticator(BearerToken("token")).
+		Use(trace("first"), trace("second")).
+		Use(HeadersMiddleware(http.Header{"X-Request-Id": {"42"}})).
+		Use(TimingMiddleware(func(req *http.Request, statusCode int, err error, duration time.Duration) {
+			timings = append(timings, fmt.Sprintf("%s %d %v", req.URL.Path, statusCode, err))
+		}))
+
+	ctx := context.Background()
+	if _, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Request(ctx); err != nil {
+		t.Fatalf("render Request() error = %v", err)
+	}
+	if _, err := client.NewFindQuery("a.*").Request(ctx); err != nil {
+		t.Fatalf("find Request() error = %v", err)
+	}
+	if _, err := client.NewTagsQuery().Request(ctx); err != nil {
+		t.Fatalf("tags Request() error = %v", err)
+	}
+
+	wantOrder := []string{"first before", "second before", "second after", "first after"}
+	if len(order) != 3*len(wantOrder) {
+		t.Fatalf("middlewares called %d times, want %d: %v", len(order), 3*len(wantOrder), order)
+	}
+	for i, s := range order {
+		if want := wantOrder[i%len(wantOrder)]; s != want {
+			t.Fatalf("order[%d] = %q, want %q", i, s, want)
+		}
+	}
+	wantTimings := []string{"/render/ 200 <nil>", "/metrics/find 200 <nil>", "/tags 200 <nil>"}
+	if strings.Join(timings, ", ") != strings.Join(wantTimings, ", ") {
+		t.Errorf("timings = %q, want %q", timings, wantTimings)
+	}
+	for i, h := range headers {
+		if h.Get("X-Request-Id") != "42" {
+			t.Errorf("request %d: X-Request-Id = %q", i, h.Get("X-Request-Id"))
+		}
+		// middleware sees authenticated request
+		if h.Get("Authorization") != "Bearer token" {
+			t.Errorf("request %d: Authorization = %q", i, h.Get("Authorization"))
+		}
+	}
+
+	// remove middlewares
+	client.SetMiddlewares()
+	order = nil
+	if _, err := client.NewFindQuery("a.*").Request(ctx); err != nil {
+		t.Fatalf("find Request() error = %v", err)
+	}
+	if len(order) != 0 {
+		t.Errorf("middlewares called after reset: %v", order)
+	}
+}
+
+func TestClient_MiddlewareRetry(t *testing.T) {
+	ts, requests := makeRetryServer([]int{502, 503}, "")
+	defer ts.Close()
+
+	retry := NewRetryPolicy(3)
+	retry.MinBackoff = time.Millisecond
+
+	var statuses []int
+	client := NewClient("http://" + ts.Listener.Addr().String()).
+		SetRetryPolicy(retry).
+		Use(TimingMiddleware(func(req *http.Request, statusCode int, err error, duration time.Duration) {
+			statuses = append(statuses, statusCode)
+		}))
+	if _, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Request(context.Background()); err != nil {
+		t.Fatalf("Request() error = %v", err)
+	}
+	// middlewares are applied for each attempt
+	if fmt.Sprint(statuses) != "[502 503 200]" || *requests != 3 {
+		t.Errorf("statuses = %v, requests = %d, want [502 503 200] and 3 requests", statuses, *requests)
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	var logs []string
+	logf := func(format string, args ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}
+	client := NewClient("http://user:secret@" + ts.Listener.Addr().String()).Use(LoggingMiddleware(logf))
+	if _, err := client.NewFindQuery("a.*").Request(context.Background()); err == nil {
+		t.Fatal("Request() must fail")
+	}
+
+	if len(logs) != 1 {
+		t.Fatalf("logs = %q, want one record", logs)
+	}
+	want := "graphite api: GET http://user:xxxxx@" + ts.Listener.Addr().String() + "/metrics/find?"
+	if !strings.HasPrefix(logs[0], want) || !strings.Contains(logs[0], ": 404 (") {
+		t.Errorf("log = %q, want %q...: 404 (duration)", logs[0], want)
+	}
+	if strings.Contains(logs[0], "secret") {
+		t.Errorf("log = %q contains password", logs[0])
+	}
+}
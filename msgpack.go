@@ -0,0 +1,238 @@
+package graphiteapi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	ErrMsgpackTruncated = errors.New("msgpack: unexpected end of data")
+	ErrMsgpackInvalid   = errors.New("msgpack: invalid data")
+)
+
+// msgpackMaxDepth limits nesting of arrays and maps
+const msgpackMaxDepth = 32
+
+// msgpackReader decodes msgpack data into go values:
+// nil, bool, int64, uint64, float64, string, []interface{}, map[string]interface{}
+type msgpackReader struct {
+	data []byte
+	pos  int
+}
+
+func unmarshallMsgpack(data []byte) (interface{}, error) {
+	r := msgpackReader{data: data}
+	v, err := r.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if r.pos != len(r.data) {
+		return nil, ErrMsgpackInvalid
+	}
+	return v, nil
+}
+
+func (r *msgpackReader) read(n int) ([]byte, error) {
+	if n < 0 || n > len(r.data)-r.pos {
+		return nil, ErrMsgpackTruncated
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *msgpackReader) uint(n int) (uint64, error) {
+	b, err := r.read(n)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+func (r *msgpackReader) str(n uint64) (string, error) {
+	if n > uint64(len(r.data)) {
+		return "", ErrMsgpackTruncated
+	}
+	b, err := r.read(int(n))
+	return string(b), err
+}
+
+func (r *msgpackReader) array(n uint64, depth int) ([]interface{}, error) {
+	if n > uint64(len(r.data)-r.pos) {
+		return nil, ErrMsgpackTruncated
+	}
+	a := make([]interface{}, n)
+	for i := range a {
+		v, err := r.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		a[i] = v
+	}
+	return a, nil
+}
+
+func (r *msgpackReader) dict(n uint64, depth int) (map[string]interface{}, error) {
+	if n > uint64(len(r.data)-r.pos) {
+		return nil, ErrMsgpackTruncated
+	}
+	m := make(map[string]interface{}, n)
+	for i := uint64(0); i < n; i++ {
+		k, err := r.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("msgpack: unsupported map key type %T", k)
+		}
+		if m[key], err = r.value(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (r *msgpackReader) value(depth int) (interface{}, error) {
+	if depth > msgpackMaxDepth {
+		return nil, ErrMsgpackInvalid
+	}
+	if r.pos >= len(r.data) {
+		return nil, ErrMsgpackTruncated
+	}
+	b := r.data[r.pos]
+	r.pos++
+	switch {
+	case b <= 0x7f: // positive fixint
+		return int64(b), nil
+	case b <= 0x8f: // fixmap
+		return r.dict(uint64(b&0x0f), depth)
+	case b <= 0x9f: // fixarray
+		return r.array(uint64(b&0x0f), depth)
+	case b <= 0xbf: // fixstr
+		return r.str(uint64(b & 0x1f))
+	case b >= 0xe0: // negative fixint
+		return int64(int8(b)), nil
+	}
+
+	var (
+		n   uint64
+		err error
+	)
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xd9: // bin8, str8
+		if n, err = r.uint(1); err != nil {
+			return nil, err
+		}
+		return r.str(n)
+	case 0xc5, 0xda: // bin16, str16
+		if n, err = r.uint(2); err != nil {
+			return nil, err
+		}
+		return r.str(n)
+	case 0xc6, 0xdb: // bin32, str32
+		if n, err = r.uint(4); err != nil {
+			return nil, err
+		}
+		return r.str(n)
+	case 0xca:
+		if n, err = r.uint(4); err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(uint32(n))), nil
+	case 0xcb:
+		if n, err = r.uint(8); err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(n), nil
+	case 0xcc, 0xcd, 0xce:
+		if n, err = r.uint(1 << (b - 0xcc)); err != nil {
+			return nil, err
+		}
+		return int64(n), nil
+	case 0xcf:
+		if n, err = r.uint(8); err != nil {
+			return nil, err
+		}
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case 0xd0:
+		n, err = r.uint(1)
+		return int64(int8(n)), err
+	case 0xd1:
+		n, err = r.uint(2)
+		return int64(int16(n)), err
+	case 0xd2:
+		n, err = r.uint(4)
+		return int64(int32(n)), err
+	case 0xd3:
+		n, err = r.uint(8)
+		return int64(n), err
+	case 0xdc:
+		if n, err = r.uint(2); err != nil {
+			return nil, err
+		}
+		return r.array(n, depth)
+	case 0xdd:
+		if n, err = r.uint(4); err != nil {
+			return nil, err
+		}
+		return r.array(n, depth)
+	case 0xde:
+		if n, err = r.uint(2); err != nil {
+			return nil, err
+		}
+		return r.dict(n, depth)
+	case 0xdf:
+		if n, err = r.uint(4); err != nil {
+			return nil, err
+		}
+		return r.dict(n, depth)
+	default:
+		return nil, fmt.Errorf("msgpack: unsupported type 0x%02x at %d", b, r.pos-1)
+	}
+}
+
+// unmarshallMsgpackSeries decodes render response in msgpack format (the same series info, as in pickle format)
+func unmarshallMsgpackSeries(data []byte, maxTargets int) ([]Series, error) {
+	empty := []Series{}
+	if len(data) == 0 {
+		return empty, nil
+	}
+	v, err := unmarshallMsgpack(data)
+	if err != nil {
+		return empty, err
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return empty, ErrMsgpackInvalid
+	}
+	result := make([]Series, 0, maxTargets)
+	for _, item := range list {
+		series, err := unmarshallSeriesInfo(item, "msgpack")
+		if err != nil {
+			return empty, err
+		}
+		result = append(result, series)
+	}
+	return result, nil
+}
@@ -0,0 +1,36 @@
+package graphiteapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRenderQuery_RequestMsgpack(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/render.msgpack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if format := r.URL.Query().Get("format"); format != "msgpack" {
+			t.Errorf("Format should be msgpack but %s found", format)
+		}
+		w.Header().Set("Content-type", "application/x-msgpack")
+		w.Write(data)
+	}))
+	defer ts.Close()
+
+	q := NewClient("http://"+ts.Listener.Addr().String()).NewRenderQuery("", "", []string{"main*"}, 0).SetFormat(RenderFormatMsgpack)
+	res, err := q.Request(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same series, as in pickle fixtures
+	compareSeries(t, res, pickleSeries)
+
+	if _, err = unmarshallMsgpackSeries(data[:len(data)-2], 2); err != ErrMsgpackTruncated {
+		t.Errorf("truncated data must return error %v, got %v", ErrMsgpackTruncated, err)
+	}
+}
@@ -0,0 +1,511 @@
+package graphiteapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrPickleTruncated = errors.New("pickle: unexpected end of data")
+	ErrPickleInvalid   = errors.New("pickle: invalid data")
+)
+
+// pickle opcodes, used by graphite (a subset of python pickle protocols 0-5, without classes)
+const (
+	pickleOpMark           = '('
+	pickleOpStop           = '.'
+	pickleOpPop            = '0'
+	pickleOpPopMark        = '1'
+	pickleOpDup            = '2'
+	pickleOpFloat          = 'F'
+	pickleOpInt            = 'I'
+	pickleOpBinInt         = 'J'
+	pickleOpBinInt1        = 'K'
+	pickleOpLong           = 'L'
+	pickleOpBinInt2        = 'M'
+	pickleOpNone           = 'N'
+	pickleOpBinString      = 'T'
+	pickleOpShortBinString = 'U'
+	pickleOpUnicode        = 'V'
+	pickleOpBinUnicode     = 'X'
+	pickleOpAppend         = 'a'
+	pickleOpDict           = 'd'
+	pickleOpEmptyDict      = '}'
+	pickleOpAppends        = 'e'
+	pickleOpGet            = 'g'
+	pickleOpBinGet         = 'h'
+	pickleOpLongBinGet     = 'j'
+	pickleOpList           = 'l'
+	pickleOpEmptyList      = ']'
+	pickleOpPut            = 'p'
+	pickleOpBinPut         = 'q'
+	pickleOpLongBinPut     = 'r'
+	pickleOpSetItem        = 's'
+	pickleOpTuple          = 't'
+	pickleOpEmptyTuple     = ')'
+	pickleOpSetItems       = 'u'
+	pickleOpBinFloat       = 'G'
+	pickleOpBinBytes       = 'B'
+	pickleOpShortBinBytes  = 'C'
+
+	pickleOpProto           = 0x80
+	pickleOpTuple1          = 0x85
+	pickleOpTuple2          = 0x86
+	pickleOpTuple3          = 0x87
+	pickleOpNewTrue         = 0x88
+	pickleOpNewFalse        = 0x89
+	pickleOpLong1           = 0x8a
+	pickleOpLong4           = 0x8b
+	pickleOpShortBinUnicode = 0x8c
+	pickleOpBinUnicode8     = 0x8d
+	pickleOpBinBytes8       = 0x8e
+	pickleOpMemoize         = 0x94
+	pickleOpFrame           = 0x95
+)
+
+// pickleList is a decoded python list or tuple (pointer is needed, lists can be appended after memoize)
+type pickleList struct {
+	items []interface{}
+}
+
+// pickleMarkObj is a mark on the stack
+type pickleMarkObj struct{}
+
+// unpickler decodes python pickle data into go values:
+// None - nil, bool, int64 (or *big.Int), float64, string, *pickleList, map[string]interface{}
+type unpickler struct {
+	data  []byte
+	pos   int
+	stack []interface{}
+	memo  map[int]interface{}
+}
+
+func unpickle(data []byte) (interface{}, error) {
+	u := unpickler{data: data, memo: make(map[int]interface{})}
+	return u.load()
+}
+
+func (u *unpickler) read(n int) ([]byte, error) {
+	if n < 0 || u.pos+n > len(u.data) {
+		return nil, ErrPickleTruncated
+	}
+	b := u.data[u.pos : u.pos+n]
+	u.pos += n
+	return b, nil
+}
+
+func (u *unpickler) readByte() (byte, error) {
+	if u.pos >= len(u.data) {
+		return 0, ErrPickleTruncated
+	}
+	b := u.data[u.pos]
+	u.pos++
+	return b, nil
+}
+
+func (u *unpickler) readLine() (string, error) {
+	n := bytes.IndexByte(u.data[u.pos:], '\n')
+	if n < 0 {
+		return "", ErrPickleTruncated
+	}
+	line := string(u.data[u.pos : u.pos+n])
+	u.pos += n + 1
+	return line, nil
+}
+
+func (u *unpickler) readUint(n int) (uint64, error) {
+	b, err := u.read(n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for i := n - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, nil
+}
+
+func (u *unpickler) push(v interface{}) {
+	u.stack = append(u.stack, v)
+}
+
+func (u *unpickler) pop() (interface{}, error) {
+	if len(u.stack) == 0 {
+		return nil, ErrPickleInvalid
+	}
+	v := u.stack[len(u.stack)-1]
+	u.stack = u.stack[:len(u.stack)-1]
+	return v, nil
+}
+
+func (u *unpickler) top() (interface{}, error) {
+	if len(u.stack) == 0 {
+		return nil, ErrPickleInvalid
+	}
+	return u.stack[len(u.stack)-1], nil
+}
+
+// popMark pops items until mark
+func (u *unpickler) popMark() ([]interface{}, error) {
+	for i := len(u.stack) - 1; i >= 0; i-- {
+		if _, ok := u.stack[i].(pickleMarkObj); ok {
+			items := make([]interface{}, len(u.stack)-i-1)
+			copy(items, u.stack[i+1:])
+			u.stack = u.stack[:i]
+			return items, nil
+		}
+	}
+	return nil, ErrPickleInvalid
+}
+
+func (u *unpickler) appendItems(items []interface{}) error {
+	v, err := u.top()
+	if err != nil {
+		return err
+	}
+	l, ok := v.(*pickleList)
+	if !ok {
+		return ErrPickleInvalid
+	}
+	l.items = append(l.items, items...)
+	return nil
+}
+
+func (u *unpickler) setItems(items []interface{}) error {
+	if len(items)%2 != 0 {
+		return ErrPickleInvalid
+	}
+	v, err := u.top()
+	if err != nil {
+		return err
+	}
+	d, ok := v.(map[string]interface{})
+	if !ok {
+		return ErrPickleInvalid
+	}
+	for i := 0; i < len(items); i += 2 {
+		key, ok := items[i].(string)
+		if !ok {
+			return fmt.Errorf("pickle: unsupported dict key type %T", items[i])
+		}
+		d[key] = items[i+1]
+	}
+	return nil
+}
+
+func (u *unpickler) memoGet(idx int) error {
+	v, ok := u.memo[idx]
+	if !ok {
+		return ErrPickleInvalid
+	}
+	u.push(v)
+	return nil
+}
+
+func (u *unpickler) memoPut(idx int) error {
+	v, err := u.top()
+	if err != nil {
+		return err
+	}
+	u.memo[idx] = v
+	return nil
+}
+
+func (u *unpickler) pushString(n uint64) error {
+	if n > uint64(len(u.data)) {
+		return ErrPickleTruncated
+	}
+	b, err := u.read(int(n))
+	if err != nil {
+		return err
+	}
+	u.push(string(b))
+	return nil
+}
+
+func (u *unpickler) pushInt(v *big.Int) {
+	if v.IsInt64() {
+		u.push(v.Int64())
+	} else {
+		u.push(v)
+	}
+}
+
+// decodeLong decodes little-endian two's complement integer
+func decodeLong(b []byte) *big.Int {
+	v := new(big.Int)
+	if len(b) == 0 {
+		return v
+	}
+	be := make([]byte, len(b))
+	for i := range b {
+		be[len(b)-1-i] = b[i]
+	}
+	v.SetBytes(be)
+	if b[len(b)-1]&0x80 != 0 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(len(b))*8))
+	}
+	return v
+}
+
+func (u *unpickler) load() (interface{}, error) {
+	for {
+		op, err := u.readByte()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case pickleOpProto:
+			if _, err = u.readByte(); err != nil {
+				return nil, err
+			}
+		case pickleOpFrame:
+			_, err = u.read(8)
+		case pickleOpStop:
+			v, err := u.pop()
+			if err != nil {
+				return nil, err
+			}
+			return v, nil
+		case pickleOpMark:
+			u.push(pickleMarkObj{})
+		case pickleOpPop:
+			_, err = u.pop()
+		case pickleOpPopMark:
+			_, err = u.popMark()
+		case pickleOpDup:
+			var v interface{}
+			if v, err = u.top(); err == nil {
+				u.push(v)
+			}
+		case pickleOpNone:
+			u.push(nil)
+		case pickleOpNewTrue:
+			u.push(true)
+		case pickleOpNewFalse:
+			u.push(false)
+		case pickleOpInt:
+			var line string
+			if line, err = u.readLine(); err != nil {
+				return nil, err
+			}
+			switch line {
+			case "00":
+				u.push(false)
+			case "01":
+				u.push(true)
+			default:
+				v, ok := new(big.Int).SetString(line, 10)
+				if !ok {
+					return nil, ErrPickleInvalid
+				}
+				u.pushInt(v)
+			}
+		case pickleOpLong:
+			var line string
+			if line, err = u.readLine(); err != nil {
+				return nil, err
+			}
+			v, ok := new(big.Int).SetString(strings.TrimSuffix(line, "L"), 10)
+			if !ok {
+				return nil, ErrPickleInvalid
+			}
+			u.pushInt(v)
+		case pickleOpFloat:
+			var line string
+			if line, err = u.readLine(); err != nil {
+				return nil, err
+			}
+			var v float64
+			if v, err = strconv.ParseFloat(line, 64); err != nil {
+				return nil, err
+			}
+			u.push(v)
+		case pickleOpBinInt:
+			var v uint64
+			if v, err = u.readUint(4); err == nil {
+				u.push(int64(int32(v)))
+			}
+		case pickleOpBinInt1:
+			var v uint64
+			if v, err = u.readUint(1); err == nil {
+				u.push(int64(v))
+			}
+		case pickleOpBinInt2:
+			var v uint64
+			if v, err = u.readUint(2); err == nil {
+				u.push(int64(v))
+			}
+		case pickleOpLong1, pickleOpLong4:
+			var n uint64
+			if op == pickleOpLong1 {
+				n, err = u.readUint(1)
+			} else {
+				n, err = u.readUint(4)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if n > uint64(len(u.data)) {
+				return nil, ErrPickleTruncated
+			}
+			var b []byte
+			if b, err = u.read(int(n)); err == nil {
+				u.pushInt(decodeLong(b))
+			}
+		case pickleOpBinFloat:
+			var b []byte
+			if b, err = u.read(8); err == nil {
+				u.push(math.Float64frombits(binary.BigEndian.Uint64(b)))
+			}
+		case pickleOpShortBinString, pickleOpShortBinBytes, pickleOpShortBinUnicode:
+			var n uint64
+			if n, err = u.readUint(1); err == nil {
+				err = u.pushString(n)
+			}
+		case pickleOpBinString, pickleOpBinBytes, pickleOpBinUnicode:
+			var n uint64
+			if n, err = u.readUint(4); err == nil {
+				err = u.pushString(n)
+			}
+		case pickleOpBinUnicode8, pickleOpBinBytes8:
+			var n uint64
+			if n, err = u.readUint(8); err == nil {
+				err = u.pushString(n)
+			}
+		case pickleOpUnicode:
+			var line string
+			if line, err = u.readLine(); err == nil {
+				u.push(line)
+			}
+		case pickleOpEmptyList:
+			u.push(&pickleList{})
+		case pickleOpList:
+			var items []interface{}
+			if items, err = u.popMark(); err == nil {
+				u.push(&pickleList{items: items})
+			}
+		case pickleOpEmptyTuple:
+			u.push(&pickleList{})
+		case pickleOpTuple:
+			var items []interface{}
+			if items, err = u.popMark(); err == nil {
+				u.push(&pickleList{items: items})
+			}
+		case pickleOpTuple1, pickleOpTuple2, pickleOpTuple3:
+			n := int(op-pickleOpTuple1) + 1
+			if len(u.stack) < n {
+				return nil, ErrPickleInvalid
+			}
+			items := make([]interface{}, n)
+			copy(items, u.stack[len(u.stack)-n:])
+			u.stack = u.stack[:len(u.stack)-n]
+			u.push(&pickleList{items: items})
+		case pickleOpAppend:
+			var v interface{}
+			if v, err = u.pop(); err == nil {
+				err = u.appendItems([]interface{}{v})
+			}
+		case pickleOpAppends:
+			var items []interface{}
+			if items, err = u.popMark(); err == nil {
+				err = u.appendItems(items)
+			}
+		case pickleOpEmptyDict:
+			u.push(make(map[string]interface{}))
+		case pickleOpDict:
+			var items []interface{}
+			if items, err = u.popMark(); err == nil {
+				u.push(make(map[string]interface{}))
+				err = u.setItems(items)
+			}
+		case pickleOpSetItem:
+			var key, value interface{}
+			if value, err = u.pop(); err != nil {
+				return nil, err
+			}
+			if key, err = u.pop(); err != nil {
+				return nil, err
+			}
+			err = u.setItems([]interface{}{key, value})
+		case pickleOpSetItems:
+			var items []interface{}
+			if items, err = u.popMark(); err == nil {
+				err = u.setItems(items)
+			}
+		case pickleOpGet, pickleOpPut:
+			var line string
+			if line, err = u.readLine(); err != nil {
+				return nil, err
+			}
+			var idx int
+			if idx, err = strconv.Atoi(line); err != nil {
+				return nil, err
+			}
+			if op == pickleOpGet {
+				err = u.memoGet(idx)
+			} else {
+				err = u.memoPut(idx)
+			}
+		case pickleOpBinGet, pickleOpBinPut:
+			var idx uint64
+			if idx, err = u.readUint(1); err != nil {
+				return nil, err
+			}
+			if op == pickleOpBinGet {
+				err = u.memoGet(int(idx))
+			} else {
+				err = u.memoPut(int(idx))
+			}
+		case pickleOpLongBinGet, pickleOpLongBinPut:
+			var idx uint64
+			if idx, err = u.readUint(4); err != nil {
+				return nil, err
+			}
+			if op == pickleOpLongBinGet {
+				err = u.memoGet(int(idx))
+			} else {
+				err = u.memoPut(int(idx))
+			}
+		case pickleOpMemoize:
+			err = u.memoPut(len(u.memo))
+		default:
+			return nil, fmt.Errorf("pickle: unsupported opcode 0x%02x at %d", op, u.pos-1)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// unmarshallPickleSeries decodes render response in pickle format:
+// list of dicts with name, start, end, step, values and optional pathExpression, xFilesFactor, tags
+func unmarshallPickleSeries(data []byte, maxTargets int) ([]Series, error) {
+	empty := []Series{}
+	if len(data) == 0 {
+		return empty, nil
+	}
+	v, err := unpickle(data)
+	if err != nil {
+		return empty, err
+	}
+	list, ok := v.(*pickleList)
+	if !ok {
+		return empty, ErrPickleInvalid
+	}
+	result := make([]Series, 0, maxTargets)
+	for _, item := range list.items {
+		series, err := unmarshallSeriesInfo(item, "pickle")
+		if err != nil {
+			return empty, err
+		}
+		result = append(result, series)
+	}
+	return result, nil
+}
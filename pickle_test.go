@@ -0,0 +1,82 @@
+package graphiteapi
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var pickleSeries = []Series{
+	{
+		Target:         "main1",
+		Tags:           map[string]string{"name": "main1"},
+		PathExpression: "main*",
+		XFilesFactor:   0.5,
+		Step:           60,
+		Start:          1468339800,
+		Stop:           1468339980,
+		DataPoints: []DataPoint{
+			{Value: 1.0, Timestamp: 1468339800},
+			{Value: math.NaN(), Timestamp: 1468339860},
+			{Value: 2.5, Timestamp: 1468339920},
+		},
+	},
+	{
+		Target:         "main2",
+		Tags:           map[string]string{"name": "main2"},
+		PathExpression: "main*",
+		Step:           60,
+		Start:          1468339800,
+		Stop:           1468339980,
+		DataPoints: []DataPoint{
+			{Value: 3.0, Timestamp: 1468339800},
+			{Value: math.NaN(), Timestamp: 1468339860},
+			{Value: -1.5, Timestamp: 1468339920},
+		},
+	},
+}
+
+func TestUnmarshallPickleSeries(t *testing.T) {
+	for _, fixture := range []string{"render_proto0.pickle", "render_proto2.pickle", "render_proto4.pickle"} {
+		t.Run(fixture, func(t *testing.T) {
+			data, err := ioutil.ReadFile("testdata/" + fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := unmarshallPickleSeries(data, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareSeries(t, res, pickleSeries)
+
+			if _, err = unmarshallPickleSeries(data[:len(data)-2], 2); err != ErrPickleTruncated {
+				t.Errorf("truncated data must return error %v, got %v", ErrPickleTruncated, err)
+			}
+		})
+	}
+}
+
+func TestRenderQuery_RequestPickle(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/render_proto2.pickle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if format := r.URL.Query().Get("format"); format != "pickle" {
+			t.Errorf("Format should be pickle but %s found", format)
+		}
+		w.Header().Set("Content-type", "application/pickle")
+		w.Write(data)
+	}))
+	defer ts.Close()
+
+	q := NewClient("http://"+ts.Listener.Addr().String()).NewRenderQuery("", "", []string{"main*"}, 0).SetFormat(RenderFormatPickle)
+	res, err := q.Request(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareSeries(t, res, pickleSeries)
+}
@@ -0,0 +1,327 @@
+package graphiteapi
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var (
+	ErrProtobufTruncated = errors.New("protobuf: unexpected end of data")
+	ErrProtobufInvalid   = errors.New("protobuf: invalid data")
+)
+
+// protobuf wire types
+const (
+	pbVarint  = 0
+	pbFixed64 = 1
+	pbBytes   = 2
+	pbFixed32 = 5
+)
+
+// pbReader is a minimal protobuf wire format reader, enough for carbonapi_v2_pb and carbonapi_v3_pb messages
+type pbReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *pbReader) eof() bool {
+	return r.pos >= len(r.data)
+}
+
+func (r *pbReader) varint() (uint64, error) {
+	var v uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		if r.pos >= len(r.data) {
+			return 0, ErrProtobufTruncated
+		}
+		b := r.data[r.pos]
+		r.pos++
+		v |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return v, nil
+		}
+	}
+	return 0, ErrProtobufInvalid
+}
+
+func (r *pbReader) fixed64() (uint64, error) {
+	if r.pos+8 > len(r.data) {
+		return 0, ErrProtobufTruncated
+	}
+	v := binary.LittleEndian.Uint64(r.data[r.pos:])
+	r.pos += 8
+	return v, nil
+}
+
+func (r *pbReader) fixed32() (uint32, error) {
+	if r.pos+4 > len(r.data) {
+		return 0, ErrProtobufTruncated
+	}
+	v := binary.LittleEndian.Uint32(r.data[r.pos:])
+	r.pos += 4
+	return v, nil
+}
+
+func (r *pbReader) bytes() ([]byte, error) {
+	n, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.data)-r.pos) {
+		return nil, ErrProtobufTruncated
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+// key reads field number and wire type
+func (r *pbReader) key() (int, int, error) {
+	v, err := r.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	if v>>3 == 0 {
+		return 0, 0, ErrProtobufInvalid
+	}
+	return int(v >> 3), int(v & 7), nil
+}
+
+// skip skips field value with wire type
+func (r *pbReader) skip(wireType int) error {
+	var err error
+	switch wireType {
+	case pbVarint:
+		_, err = r.varint()
+	case pbFixed64:
+		_, err = r.fixed64()
+	case pbBytes:
+		_, err = r.bytes()
+	case pbFixed32:
+		_, err = r.fixed32()
+	default:
+		err = ErrProtobufInvalid
+	}
+	return err
+}
+
+// doubles reads repeated double field (packed or not)
+func (r *pbReader) doubles(wireType int, values []float64) ([]float64, error) {
+	switch wireType {
+	case pbFixed64:
+		v, err := r.fixed64()
+		if err != nil {
+			return nil, err
+		}
+		return append(values, math.Float64frombits(v)), nil
+	case pbBytes:
+		b, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		if len(b)%8 != 0 {
+			return nil, ErrProtobufInvalid
+		}
+		if values == nil {
+			values = make([]float64, 0, len(b)/8)
+		}
+		for i := 0; i < len(b); i += 8 {
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(b[i:])))
+		}
+		return values, nil
+	default:
+		return nil, ErrProtobufInvalid
+	}
+}
+
+// bools reads repeated bool field (packed or not)
+func (r *pbReader) bools(wireType int, values []bool) ([]bool, error) {
+	switch wireType {
+	case pbVarint:
+		v, err := r.varint()
+		if err != nil {
+			return nil, err
+		}
+		return append(values, v != 0), nil
+	case pbBytes:
+		b, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		sub := pbReader{data: b}
+		for !sub.eof() {
+			v, err := sub.varint()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v != 0)
+		}
+		return values, nil
+	default:
+		return nil, ErrProtobufInvalid
+	}
+}
+
+// int64Field reads int32/int64 varint field
+func (r *pbReader) int64Field(wireType int) (int64, error) {
+	if wireType != pbVarint {
+		return 0, ErrProtobufInvalid
+	}
+	v, err := r.varint()
+	return int64(v), err
+}
+
+// stringField reads string field
+func (r *pbReader) stringField(wireType int) (string, error) {
+	if wireType != pbBytes {
+		return "", ErrProtobufInvalid
+	}
+	b, err := r.bytes()
+	return string(b), err
+}
+
+// unmarshallMultiFetchResponse decodes MultiFetchResponse message (metrics = 1) with decoder for FetchResponse
+func unmarshallMultiFetchResponse(data []byte, maxTargets int, decode func([]byte) (Series, error)) ([]Series, error) {
+	empty := []Series{}
+	result := make([]Series, 0, maxTargets)
+	r := pbReader{data: data}
+	for !r.eof() {
+		field, wireType, err := r.key()
+		if err != nil {
+			return empty, err
+		}
+		if field != 1 {
+			if err = r.skip(wireType); err != nil {
+				return empty, err
+			}
+			continue
+		}
+		if wireType != pbBytes {
+			return empty, ErrProtobufInvalid
+		}
+		b, err := r.bytes()
+		if err != nil {
+			return empty, err
+		}
+		series, err := decode(b)
+		if err != nil {
+			return empty, err
+		}
+		result = append(result, series)
+	}
+	return result, nil
+}
+
+// makeDataPoints builds datapoints from values, absent values are set to NaN
+func makeDataPoints(start, step int64, values []float64, isAbsent []bool) []DataPoint {
+	datapoints := make([]DataPoint, len(values))
+	ts := start
+	for i, v := range values {
+		if i < len(isAbsent) && isAbsent[i] {
+			v = math.NaN()
+		}
+		datapoints[i] = DataPoint{Value: v, Timestamp: ts}
+		ts += step
+	}
+	return datapoints
+}
+
+// unmarshallProtobufV2Series decodes render response in carbonapi_v2_pb format
+func unmarshallProtobufV2Series(data []byte, maxTargets int) ([]Series, error) {
+	return unmarshallMultiFetchResponse(data, maxTargets, unmarshallProtobufV2Serie)
+}
+
+// unmarshallProtobufV2Serie decodes carbonapi_v2_pb FetchResponse:
+// name = 1, startTime = 2, stopTime = 3, stepTime = 4, values = 5, isAbsent = 6
+func unmarshallProtobufV2Serie(data []byte) (Series, error) {
+	var (
+		series   Series
+		values   []float64
+		isAbsent []bool
+		v        int64
+	)
+	r := pbReader{data: data}
+	for !r.eof() {
+		field, wireType, err := r.key()
+		if err != nil {
+			return Series{}, err
+		}
+		switch field {
+		case 1:
+			series.Target, err = r.stringField(wireType)
+		case 2:
+			v, err = r.int64Field(wireType)
+			series.Start = int64(int32(v))
+		case 3:
+			v, err = r.int64Field(wireType)
+			series.Stop = int64(int32(v))
+		case 4:
+			v, err = r.int64Field(wireType)
+			series.Step = int64(int32(v))
+		case 5:
+			values, err = r.doubles(wireType, values)
+		case 6:
+			isAbsent, err = r.bools(wireType, isAbsent)
+		default:
+			err = r.skip(wireType)
+		}
+		if err != nil {
+			return Series{}, err
+		}
+	}
+	series.DataPoints = makeDataPoints(series.Start, series.Step, values, isAbsent)
+	return series, nil
+}
+
+// unmarshallProtobufV3Series decodes render response in carbonapi_v3_pb format
+func unmarshallProtobufV3Series(data []byte, maxTargets int) ([]Series, error) {
+	return unmarshallMultiFetchResponse(data, maxTargets, unmarshallProtobufV3Serie)
+}
+
+// unmarshallProtobufV3Serie decodes carbonapi_v3_pb FetchResponse:
+// name = 1, pathExpression = 2, consolidationFunc = 3, startTime = 4, stopTime = 5, stepTime = 6,
+// xFilesFactor = 7, values = 9 (absent values are NaN)
+func unmarshallProtobufV3Serie(data []byte) (Series, error) {
+	var (
+		series Series
+		values []float64
+	)
+	r := pbReader{data: data}
+	for !r.eof() {
+		field, wireType, err := r.key()
+		if err != nil {
+			return Series{}, err
+		}
+		switch field {
+		case 1:
+			series.Target, err = r.stringField(wireType)
+		case 2:
+			series.PathExpression, err = r.stringField(wireType)
+		case 3:
+			series.ConsolidationFunc, err = r.stringField(wireType)
+		case 4:
+			series.Start, err = r.int64Field(wireType)
+		case 5:
+			series.Stop, err = r.int64Field(wireType)
+		case 6:
+			series.Step, err = r.int64Field(wireType)
+		case 7:
+			if wireType != pbFixed32 {
+				return Series{}, ErrProtobufInvalid
+			}
+			var v uint32
+			v, err = r.fixed32()
+			series.XFilesFactor = float64(math.Float32frombits(v))
+		case 9:
+			values, err = r.doubles(wireType, values)
+		default:
+			err = r.skip(wireType)
+		}
+		if err != nil {
+			return Series{}, err
+		}
+	}
+	series.DataPoints = makeDataPoints(series.Start, series.Step, values, nil)
+	return series, nil
+}
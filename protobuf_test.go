@@ -0,0 +1,96 @@
+package graphiteapi
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUnmarshallProtobufSeries(t *testing.T) {
+	datapoints := [][]DataPoint{
+		{
+			{Value: 1.0, Timestamp: 1468339800},
+			{Value: math.NaN(), Timestamp: 1468339860},
+			{Value: 2.5, Timestamp: 1468339920},
+		},
+		{
+			{Value: 3.0, Timestamp: 1468339800},
+			{Value: math.NaN(), Timestamp: 1468339860},
+			{Value: -1.5, Timestamp: 1468339920},
+		},
+	}
+	tests := []struct {
+		format  RenderFormat
+		fixture string
+		want    []Series
+	}{
+		{
+			format:  RenderFormatProtobuf,
+			fixture: "render.carbonapi_v2_pb",
+			want: []Series{
+				{Target: "main1", Step: 60, Start: 1468339800, Stop: 1468339980, DataPoints: datapoints[0]},
+				{Target: "main2", Step: 60, Start: 1468339800, Stop: 1468339980, DataPoints: datapoints[1]},
+			},
+		},
+		{
+			format:  RenderFormatCarbonAPIV3PB,
+			fixture: "render.carbonapi_v3_pb",
+			want: []Series{
+				{
+					Target: "main1", PathExpression: "main*", ConsolidationFunc: "average", XFilesFactor: 0.5,
+					Step: 60, Start: 1468339800, Stop: 1468339980, DataPoints: datapoints[0],
+				},
+				{
+					Target: "main2", PathExpression: "main*", ConsolidationFunc: "average", XFilesFactor: 0.5,
+					Step: 60, Start: 1468339800, Stop: 1468339980, DataPoints: datapoints[1],
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			data, err := ioutil.ReadFile("testdata/" + tt.fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// carbonapi_v3_pb is also accepted with application/x-protobuf content type
+			for _, contentType := range tt.format.contentTypes() {
+				ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if format := r.URL.Query().Get("format"); format != string(tt.format) {
+						t.Errorf("Format should be %s but %s found", tt.format, format)
+					}
+					w.Header().Set("Content-type", contentType)
+					w.Write(data)
+				}))
+
+				q := NewClient("http://"+ts.Listener.Addr().String()).NewRenderQuery("", "", []string{"main*"}, 0).SetFormat(tt.format)
+				res, err := q.Request(context.Background())
+				if err != nil {
+					ts.Close()
+					t.Fatalf("Request() with %s error = %v", contentType, err)
+				}
+				compareSeries(t, res, tt.want)
+
+				var streamed []Series
+				if err = q.RequestEach(context.Background(), func(s Series) error {
+					streamed = append(streamed, s)
+					return nil
+				}); err != nil {
+					ts.Close()
+					t.Fatalf("RequestEach() with %s error = %v", contentType, err)
+				}
+				compareSeries(t, streamed, tt.want)
+				ts.Close()
+			}
+
+			if _, err = tt.format.unmarshallSeries(data[:len(data)-3], 2, 0, time.UTC); err != ErrProtobufTruncated {
+				t.Errorf("truncated data must return error %v, got %v", ErrProtobufTruncated, err)
+			}
+		})
+	}
+}
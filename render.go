@@ -1,10 +1,15 @@
 package graphiteapi
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // NewRenderQuery returns a RenderQuery instance
@@ -19,6 +24,28 @@ func NewRenderQuery(base, from, until string, targets []string, maxDataPoints in
 	return q
 }
 
+// SetClient sets client, used for requests
+func (q *RenderQuery) SetClient(client *Client) *RenderQuery {
+	q.client = client
+	return q
+}
+
+// Client returns client, used for requests
+func (q *RenderQuery) Client() *Client {
+	if q.client == nil {
+		return DefaultClient
+	}
+	return q.client
+}
+
+// base returns base url from query or from client, if not set
+func (q *RenderQuery) base() string {
+	if q.Base == "" {
+		return q.Client().Base()
+	}
+	return q.Base
+}
+
 func (q *RenderQuery) SetBasicAuth(username, password string) {
 	q.User = username
 	q.Password = password
@@ -34,6 +61,71 @@ func (q *RenderQuery) SetUntil(until string) *RenderQuery {
 	return q
 }
 
+// SetFromTime sets from as unix timestamp
+func (q *RenderQuery) SetFromTime(from time.Time) *RenderQuery {
+	q.From = FormatATTime(from)
+	return q
+}
+
+// SetUntilTime sets until as unix timestamp
+func (q *RenderQuery) SetUntilTime(until time.Time) *RenderQuery {
+	q.Until = FormatATTime(until)
+	return q
+}
+
+func (q *RenderQuery) SetTz(tz string) *RenderQuery {
+	q.Tz = tz
+	return q
+}
+
+// location returns location for query timezone (UTC, if not set)
+func (q *RenderQuery) location() (*time.Location, error) {
+	if q.Tz == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(q.Tz)
+}
+
+// decodeLocation returns location for decode response timestamps.
+// csv timestamps are formatted in server timezone without offset, so timezone must be set for decode.
+func (q *RenderQuery) decodeLocation() (*time.Location, error) {
+	if q.format() == RenderFormatCSV && q.Tz == "" {
+		return nil, fmt.Errorf("%w: csv timestamps are formatted in server timezone", ErrTimezoneRequired)
+	}
+	return q.location()
+}
+
+// TimeRange parses from (-24h, if not set) and until (now, if not set) in query timezone, relative to now.
+// Can be used for validate query or calculate expected points count.
+// Absolute time (like `20:00_20231012` or `midnight`) is parsed by server in server timezone, so ErrTimezoneRequired
+// is returned for it, if query timezone is not set.
+func (q *RenderQuery) TimeRange(now time.Time) (from, until time.Time, err error) {
+	var loc *time.Location
+	if loc, err = q.location(); err != nil {
+		return
+	}
+	fromSpec, untilSpec := q.From, q.Until
+	if fromSpec == "" {
+		fromSpec = "-24h"
+	}
+	if untilSpec == "" {
+		untilSpec = "now"
+	}
+	if q.Tz == "" {
+		for _, spec := range []string{fromSpec, untilSpec} {
+			if !isZoneIndependentATTime(spec) {
+				err = fmt.Errorf("%w: %s is parsed in server timezone", ErrTimezoneRequired, spec)
+				return
+			}
+		}
+	}
+	if from, err = ParseATTime(fromSpec, loc, now); err != nil {
+		return
+	}
+	until, err = ParseATTime(untilSpec, loc, now)
+	return
+}
+
 func (q *RenderQuery) SetTargets(targets []string) *RenderQuery {
 	q.Targets = targets
 	return q
@@ -49,16 +141,91 @@ func (q *RenderQuery) SetMaxDataPoints(maxDataPoints int) *RenderQuery {
 	return q
 }
 
-// URL implements Query interface
-func (q *RenderQuery) URL() (*url.URL, error) {
-	u, err := url.Parse(q.Base + "/render/")
-	if err != nil {
-		return nil, err
+// SetFormat sets response format (json, if not set)
+func (q *RenderQuery) SetFormat(format RenderFormat) *RenderQuery {
+	q.Format = format
+	return q
+}
+
+func (q *RenderQuery) format() RenderFormat {
+	if q.Format == "" {
+		return RenderFormatJSON
+	}
+	return q.Format
+}
+
+// contentType returns expected response content type for format
+func (f RenderFormat) contentType() string {
+	switch f {
+	case RenderFormatPickle:
+		return "application/pickle"
+	case RenderFormatProtobuf:
+		return "application/x-protobuf"
+	case RenderFormatCarbonAPIV3PB:
+		return "application/x-carbonapi-v3-pb"
+	case RenderFormatMsgpack:
+		return "application/x-msgpack"
+	case RenderFormatCSV:
+		return "text/csv"
+	default:
+		return "application/json"
+	}
+}
+
+// contentTypes returns accepted response content types for format
+// (carbonapi and graphite-clickhouse send application/x-protobuf for carbonapi_v3_pb)
+func (f RenderFormat) contentTypes() []string {
+	if f == RenderFormatCarbonAPIV3PB {
+		return []string{f.contentType(), RenderFormatProtobuf.contentType()}
+	}
+	return []string{f.contentType()}
+}
+
+// unmarshallSeries decodes render response in format
+func (f RenderFormat) unmarshallSeries(data []byte, maxTargets, maxDataPoints int, loc *time.Location) ([]Series, error) {
+	switch f {
+	case RenderFormatJSON:
+		return unmarshallSeries(data, maxTargets, maxDataPoints)
+	case RenderFormatPickle:
+		return unmarshallPickleSeries(data, maxTargets)
+	case RenderFormatProtobuf:
+		return unmarshallProtobufV2Series(data, maxTargets)
+	case RenderFormatCarbonAPIV3PB:
+		return unmarshallProtobufV3Series(data, maxTargets)
+	case RenderFormatMsgpack:
+		return unmarshallMsgpackSeries(data, maxTargets)
+	case RenderFormatCSV:
+		return unmarshallCSVSeries(data, maxTargets, loc)
+	default:
+		return []Series{}, fmt.Errorf("unsupported render format: %s", f)
 	}
+}
+
+// Time returns datapoint timestamp as time.Time (with milliseconds)
+func (p DataPoint) Time() time.Time {
+	return time.Unix(p.Timestamp, int64(p.Millis)*int64(time.Millisecond))
+}
+
+// UnixMilli returns datapoint timestamp in milliseconds
+func (p DataPoint) UnixMilli() int64 {
+	return p.Timestamp*1000 + int64(p.Millis)
+}
+
+// SetMethod sets http method for request
+func (q *RenderQuery) SetMethod(method RenderMethod) *RenderQuery {
+	q.Method = method
+	return q
+}
+
+// values returns query parameters
+func (q *RenderQuery) values() url.Values {
 	v := url.Values{}
 
-	// force set format to json
-	v.Set("format", "json")
+	format := q.format()
+	v.Set("format", string(format))
+	if q.Tz != "" {
+		v.Set("tz", q.Tz)
+	}
 
 	for _, target := range q.Targets {
 		v.Add("target", target)
@@ -76,36 +243,134 @@ func (q *RenderQuery) URL() (*url.URL, error) {
 		v.Set("maxDataPoints", strconv.Itoa(q.MaxDataPoints))
 	}
 
-	u.RawQuery = v.Encode()
+	return v
+}
+
+// URL implements Query interface (url for GET request)
+func (q *RenderQuery) URL() (*url.URL, error) {
+	u, err := url.Parse(q.base() + "/render/")
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = q.values().Encode()
 
 	return u, nil
 }
 
-// Request implements Query interface
-func (q *RenderQuery) Request(ctx context.Context) ([]Series, error) {
+// renderJSONBody encodes query parameters as json object for carbonapi (target is always an array)
+func renderJSONBody(v url.Values) ([]byte, error) {
+	body := make(map[string]interface{}, len(v))
+	for key, values := range v {
+		if key == "target" || len(values) > 1 {
+			body[key] = values
+		} else {
+			body[key] = values[0]
+		}
+	}
+	return json.Marshal(body)
+}
+
+// newRequest returns GET or POST request for query with client (POST with RenderMethodAuto, if url is too long)
+func (q *RenderQuery) newRequest(client *Client) (*http.Request, error) {
+	u, err := q.URL()
+	if err != nil {
+		return nil, err
+	}
+
+	method := q.Method
+	if method == RenderMethodAuto {
+		method = RenderMethodGet
+		if maxLen := client.MaxURLLength(); maxLen > 0 && len(u.String()) > maxLen {
+			method = RenderMethodPost
+		}
+	}
+
 	var req *http.Request
+	switch method {
+	case RenderMethodGet:
+		if req, err = client.httpNewRequest("GET", u.String(), nil); err != nil {
+			return nil, err
+		}
+	case RenderMethodPost:
+		body := u.RawQuery
+		u.RawQuery = ""
+		if req, err = client.httpNewRequest("POST", u.String(), strings.NewReader(body)); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	case RenderMethodPostJSON:
+		body, err := renderJSONBody(q.values())
+		if err != nil {
+			return nil, err
+		}
+		u.RawQuery = ""
+		if req, err = client.httpNewRequest("POST", u.String(), bytes.NewReader(body)); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+	default:
+		return nil, fmt.Errorf("unsupported render method: %d", method)
+	}
+	if method != RenderMethodGet {
+		// render is read-only, so POST request can be hedged (nil header value is not sent)
+		req.Header["Idempotency-Key"] = nil
+	}
+
+	if len(q.User) > 0 {
+		req = withAuthenticator(req, BasicAuth(q.User, q.Password))
+	}
+
+	return req, nil
+}
 
-	url, err := q.URL()
+// RequestRaw does request and returns raw response body in query format (for example, csv)
+func (q *RenderQuery) RequestRaw(ctx context.Context) (data []byte, err error) {
+	client := q.Client()
+	req, err := q.newRequest(client)
 	if err != nil {
 		return nil, err
 	}
 
-	if req, err = httpNewRequest("GET", url.String(), nil); err != nil {
+	ctx, span := client.startSpan(ctx, req.URL.Path, q.spanAttributes()...)
+	defer func() { endSpan(span, err) }()
+
+	if data, err = client.httpDo(ctx, req, q.format().contentTypes()...); err != nil {
 		return nil, err
 	}
+	span.SetAttributes(attrResponseSize.Int(len(data)))
+	return data, nil
+}
 
-	if len(q.User) > 0 {
-		req.SetBasicAuth(q.User, q.Password)
+// Request implements Query interface
+func (q *RenderQuery) Request(ctx context.Context) (series []Series, err error) {
+	loc, err := q.decodeLocation()
+	if err != nil {
+		return nil, err
 	}
 
-	data, err := httpDo(ctx, req)
+	client := q.Client()
+	req, err := q.newRequest(client)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, span := client.startSpan(ctx, req.URL.Path, q.spanAttributes()...)
+	defer func() { endSpan(span, err) }()
+
+	// response body is read into reused buffer, decoded series don't reference it
+	buf, err := client.httpDoBuffer(ctx, req, q.format().contentTypes()...)
 	if err != nil {
 		return nil, err
 	}
+	defer putBuffer(buf)
+	span.SetAttributes(attrResponseSize.Int(buf.Len()))
 
-	metrics, err := unmarshallSeries(data, len(q.Targets), q.MaxDataPoints)
+	start := time.Now()
+	metrics, err := q.format().unmarshallSeries(buf.Bytes(), len(q.Targets), q.MaxDataPoints, loc)
+	span.SetAttributes(decodeTime(time.Since(start)))
 	if err != nil {
 		return []Series{}, err
 	}
+	span.SetAttributes(attrSeries.Int(len(metrics)))
 	return metrics, nil
 }
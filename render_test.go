@@ -2,6 +2,7 @@ package graphiteapi
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math"
 	"net/http"
@@ -9,7 +10,9 @@ import (
 	"net/url"
 	"reflect"
 	"strconv"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func compareSeries(t *testing.T, res, want []Series) {
@@ -23,6 +26,13 @@ func compareSeries(t *testing.T, res, want []Series) {
 		} else if i >= len(want) {
 			t.Errorf("+ [%d] = %+v", i, res[i])
 		} else {
+			if res[i].Target != want[i].Target || !reflect.DeepEqual(res[i].Tags, want[i].Tags) ||
+				res[i].PathExpression != want[i].PathExpression || res[i].XFilesFactor != want[i].XFilesFactor ||
+				res[i].ConsolidationFunc != want[i].ConsolidationFunc ||
+				res[i].Step != want[i].Step || res[i].Start != want[i].Start || res[i].Stop != want[i].Stop {
+				t.Errorf("- [%d] = %+v", i, want[i])
+				t.Errorf("+ [%d] = %+v", i, res[i])
+			}
 			maxWidth := len(res[i].DataPoints)
 			if maxWidth < len(want[i].DataPoints) {
 				maxWidth = len(want[i].DataPoints)
@@ -33,7 +43,7 @@ func compareSeries(t *testing.T, res, want []Series) {
 				} else if j >= len(want[i].DataPoints) {
 					t.Errorf("+ [%d][%d] = %+v", i, j, res[i].DataPoints[j])
 				} else if want[i].DataPoints[j].Value == res[i].DataPoints[j].Value {
-					if want[i].DataPoints[j].Timestamp != res[i].DataPoints[j].Timestamp {
+					if want[i].DataPoints[j].UnixMilli() != res[i].DataPoints[j].UnixMilli() {
 						t.Errorf("- [%d][%d] = %+v", i, j, want[i].DataPoints[j])
 						t.Errorf("+ [%d][%d] = %+v", i, j, res[i].DataPoints[j])
 					}
@@ -135,3 +145,119 @@ func TestGraphiteClient_Query(t *testing.T) {
 		})
 	}
 }
+
+func TestRenderQuery_Method(t *testing.T) {
+	manyTargets := make([]string, 200)
+	for i := range manyTargets {
+		manyTargets[i] = "some.long.metric.path.number." + strconv.Itoa(i)
+	}
+	tests := []struct {
+		name        string
+		method      RenderMethod
+		targets     []string
+		wantMethod  string
+		contentType string
+	}{
+		{name: "auto short", targets: []string{"a.b"}, wantMethod: "GET"},
+		{name: "auto long", targets: manyTargets, wantMethod: "POST", contentType: "application/x-www-form-urlencoded"},
+		{name: "get long", method: RenderMethodGet, targets: manyTargets, wantMethod: "GET"},
+		{name: "post", method: RenderMethodPost, targets: []string{"a.b"}, wantMethod: "POST", contentType: "application/x-www-form-urlencoded"},
+		{name: "post json", method: RenderMethodPostJSON, targets: manyTargets, wantMethod: "POST", contentType: "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != tt.wantMethod {
+					t.Errorf("method = %s, want %s", r.Method, tt.wantMethod)
+				}
+				if ct := r.Header.Get("Content-Type"); ct != tt.contentType {
+					t.Errorf("Content-Type = %q, want %q", ct, tt.contentType)
+				}
+				if _, ok := r.Header["Idempotency-Key"]; ok {
+					t.Error("Idempotency-Key header must not be sent")
+				}
+				var (
+					targets []string
+					from    string
+				)
+				if tt.contentType == "application/json" {
+					var body struct {
+						Target []string `json:"target"`
+						From   string   `json:"from"`
+					}
+					if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+						t.Fatal(err)
+					}
+					targets, from = body.Target, body.From
+				} else {
+					if err := r.ParseForm(); err != nil {
+						t.Fatal(err)
+					}
+					if tt.wantMethod == "POST" && len(r.URL.RawQuery) > 0 {
+						t.Errorf("POST url query must be empty, got %q", r.URL.RawQuery)
+					}
+					targets, from = r.Form["target"], r.Form.Get("from")
+				}
+				if !reflect.DeepEqual(targets, tt.targets) {
+					t.Errorf("got %d targets, want %d", len(targets), len(tt.targets))
+				}
+				if from != "-1h" {
+					t.Errorf("from = %q, want %q", from, "-1h")
+				}
+				w.Header().Set("Content-type", "application/json")
+				w.Write([]byte("[]"))
+			}))
+			defer ts.Close()
+
+			client := NewClient("http://" + ts.Listener.Addr().String())
+			q := client.NewRenderQuery("-1h", "", tt.targets, 0).SetMethod(tt.method)
+			if _, err := q.Request(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRenderQuery_PostHedged(t *testing.T) {
+	backends := newTestBackends(t, 2, []time.Duration{time.Second, 0}, nil)
+	defer closeTestBackends(backends)
+
+	client := NewClient("").SetBackends(testBackendsBases(backends), BalancePriority).
+		SetHedging(&HedgePolicy{Delay: 50 * time.Millisecond})
+	q := client.NewRenderQuery("", "", []string{"a.b"}, 0).SetMethod(RenderMethodPost)
+	if _, err := q.Request(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if stats := client.HedgeStats(); stats.Won != 1 {
+		t.Errorf("HedgeStats() = %+v, want hedged request won", stats)
+	}
+}
+
+// series, decoded from pooled buffer, must not be changed by next requests
+func TestRenderQuery_RequestBufferReuse(t *testing.T) {
+	var n int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := atomic.AddInt32(&n, 1)
+		w.Header().Set("Content-type", "application/json")
+		fmt.Fprintf(w, `[{"target": "target%d", "tags": {"name": "name%d"}, "datapoints": [[%d, 1]]}]`, i, i, i)
+	}))
+	defer ts.Close()
+
+	q := NewClient("http://"+ts.Listener.Addr().String()).NewRenderQuery("", "", []string{"*"}, 0)
+	var results [][]Series
+	for i := 0; i < 10; i++ {
+		res, err := q.Request(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, res)
+	}
+	for i, res := range results {
+		want := []Series{{
+			Target:     "target" + strconv.Itoa(i+1),
+			Tags:       map[string]string{"name": "name" + strconv.Itoa(i+1)},
+			DataPoints: []DataPoint{{Value: float64(i + 1), Timestamp: 1}},
+		}}
+		compareSeries(t, res, want)
+	}
+}
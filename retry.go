@@ -0,0 +1,215 @@
+package graphiteapi
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// DefaultRetryStatusCodes is a list of http status codes, retried by default
+var DefaultRetryStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// DefaultMaxRetryAfter limits Retry-After wait, if MaxBackoff is not set
+const DefaultMaxRetryAfter = time.Minute
+
+// RetryAttempt describes a single request attempt, passed to RetryPolicy.OnAttempt hook
+type RetryAttempt struct {
+	Attempt    int           // attempt number, starts from 1
+	Request    *http.Request // request, used for attempt
+	Backend    string        // base url of backend, used for attempt
+	StatusCode int           // http status code, 0 on network error
+	Err        error         // attempt error, nil on success
+	Duration   time.Duration // attempt duration
+	Backoff    time.Duration // wait before next attempt, 0 if request will not be retried
+}
+
+// RetryPolicy describes retries of failed requests with exponential backoff and jitter.
+type RetryPolicy struct {
+	MaxAttempts int           // max attempts (including the first one), retries are disabled if less than 2
+	MinBackoff  time.Duration // backoff before the first retry
+	MaxBackoff  time.Duration // max backoff, 0 for unlimited
+	Multiplier  float64       // backoff multiplier for next retry, 2 if not set
+	Jitter      float64       // randomize backoff with fraction (0.0 - 1.0), backoff is reduced on random part of Jitter * backoff
+
+	RetryStatusCodes   []int // http status codes for retry, DefaultRetryStatusCodes if nil
+	RetryNetworkErrors bool  // retry on network errors (connection refused, reset, timeout, etc.), non-idempotent requests are retried only if not sent
+	IgnoreRetryAfter   bool  // ignore Retry-After response header (request isn't retried, if Retry-After exceeds MaxBackoff)
+
+	OnAttempt func(attempt RetryAttempt) // called after each attempt, if set
+}
+
+// NewRetryPolicy returns a RetryPolicy with maxAttempts and default settings: backoff from 100ms up to 5s with 0.2 jitter,
+// retry on DefaultRetryStatusCodes and network errors
+func NewRetryPolicy(maxAttempts int) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:        maxAttempts,
+		MinBackoff:         100 * time.Millisecond,
+		MaxBackoff:         5 * time.Second,
+		Multiplier:         2,
+		Jitter:             0.2,
+		RetryNetworkErrors: true,
+	}
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p == nil || p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// backoff returns backoff before retry (starts from 1)
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	backoff := float64(p.MinBackoff) * math.Pow(multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		jitter := p.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		backoff -= backoff * jitter * rand.Float64()
+	}
+	return time.Duration(backoff)
+}
+
+func (p *RetryPolicy) isRetryableStatus(statusCode int) bool {
+	codes := p.RetryStatusCodes
+	if codes == nil {
+		codes = DefaultRetryStatusCodes
+	}
+	for _, code := range codes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// isRetryableError checks for transient network errors and attempt timeout (but not for context cancel).
+// Certificate verification, bad url and redirect policy errors are not retried.
+func isRetryableError(err error) bool {
+	if errors.Is(err, context.Canceled) || isCertificateError(err) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "read")
+}
+
+// isNotSentError checks for network errors, when request is not sent to server (connection is not established)
+func isNotSentError(err error) bool {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isCertificateError checks for TLS certificate verification errors
+func isCertificateError(err error) bool {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		invalidCert      x509.CertificateInvalidError
+		hostname         x509.HostnameError
+		recordHeader     tls.RecordHeaderError
+	)
+	return errors.As(err, &unknownAuthority) || errors.As(err, &invalidCert) || errors.As(err, &hostname) ||
+		errors.As(err, &recordHeader)
+}
+
+// parseRetryAfter parses Retry-After header value (seconds or http date)
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// retryBackoff returns backoff before next attempt or false, if request must not be retried.
+// Non-idempotent request is retried on network error only if it was not sent (server may already process it).
+func (p *RetryPolicy) retryBackoff(ctx context.Context, attempt int, idempotent bool, statusCode int, header http.Header, err error) (time.Duration, bool) {
+	if attempt >= p.maxAttempts() || ctx.Err() != nil {
+		return 0, false
+	}
+	if statusCode == 0 {
+		if err == nil || !p.RetryNetworkErrors || !isRetryableError(err) {
+			return 0, false
+		}
+		if !idempotent && !isNotSentError(err) {
+			return 0, false
+		}
+	} else if !p.isRetryableStatus(statusCode) {
+		return 0, false
+	}
+
+	backoff := p.backoff(attempt)
+	if !p.IgnoreRetryAfter && header != nil {
+		if retryAfter, ok := parseRetryAfter(header.Get("Retry-After"), time.Now()); ok && retryAfter > backoff {
+			maxRetryAfter := p.MaxBackoff
+			if maxRetryAfter <= 0 {
+				maxRetryAfter = DefaultMaxRetryAfter
+			}
+			if retryAfter > maxRetryAfter {
+				// server asks to wait too long
+				return 0, false
+			}
+			backoff = retryAfter
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= backoff {
+		// no time left for next attempt
+		return 0, false
+	}
+	return backoff, true
+}
+
+// sleepContext waits for d or context done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,289 @@
+package graphiteapi
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := &RetryPolicy{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second}
+	for i, w := range want {
+		if got := p.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(1); got < 50*time.Millisecond || got > 100*time.Millisecond {
+			t.Fatalf("backoff(1) with jitter = %v, want [50ms, 100ms]", got)
+		}
+	}
+}
+
+func makeRetryServer(statuses []int, retryAfter string) (*httptest.Server, *int32) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&requests, 1))
+		status := 200
+		if n <= len(statuses) {
+			status = statuses[n-1]
+		}
+		if status != 200 {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		w.Write([]byte("[]"))
+	}))
+	return ts, &requests
+}
+
+func TestClient_Retry(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		retryAfter   string
+		timeout      time.Duration
+		wantRequests int32
+		wantErr      bool
+	}{
+		{name: "success", statuses: []int{502, 503}, wantRequests: 3},
+		{name: "max attempts", statuses: []int{502, 503, 504, 502}, wantRequests: 3, wantErr: true},
+		{name: "not retryable", statuses: []int{400}, wantRequests: 1, wantErr: true},
+		{name: "retry-after", statuses: []int{429}, retryAfter: "1", wantRequests: 2},
+		{name: "retry-after exceed deadline", statuses: []int{429}, retryAfter: "10", timeout: time.Second, wantRequests: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, requests := makeRetryServer(tt.statuses, tt.retryAfter)
+			defer ts.Close()
+
+			var attempts []RetryAttempt
+			retry := NewRetryPolicy(3)
+			retry.MinBackoff = time.Millisecond
+			retry.OnAttempt = func(attempt RetryAttempt) {
+				attempts = append(attempts, attempt)
+			}
+			client := NewClient("http://" + ts.Listener.Addr().String()).SetRetryPolicy(retry)
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			start := time.Now()
+			_, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Request(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Request() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if *requests != tt.wantRequests {
+				t.Errorf("got %d requests, want %d", *requests, tt.wantRequests)
+			}
+			if len(attempts) != int(tt.wantRequests) {
+				t.Fatalf("got %d attempts, want %d", len(attempts), tt.wantRequests)
+			}
+			for i, attempt := range attempts {
+				if attempt.Attempt != i+1 {
+					t.Errorf("attempts[%d].Attempt = %d", i, attempt.Attempt)
+				}
+			}
+			if tt.retryAfter == "1" && time.Since(start) < time.Second {
+				t.Errorf("Retry-After not respected, request ended in %v", time.Since(start))
+			}
+			if tt.timeout > 0 && time.Since(start) >= tt.timeout {
+				t.Errorf("deadline not respected, request ended in %v", time.Since(start))
+			}
+		})
+	}
+}
+
+func TestClient_RetryNetworkError(t *testing.T) {
+	ts, _ := makeRetryServer(nil, "")
+	base := "http://" + ts.Listener.Addr().String()
+	ts.Close()
+
+	var attempts int
+	retry := NewRetryPolicy(2)
+	retry.MinBackoff = time.Millisecond
+	retry.OnAttempt = func(attempt RetryAttempt) {
+		attempts++
+		if attempt.StatusCode != 0 || attempt.Err == nil {
+			t.Errorf("attempt must fail with network error: %+v", attempt)
+		}
+	}
+	_, err := NewClient(base).SetRetryPolicy(retry).NewRenderQuery("", "", []string{"a.b"}, 0).Request(context.Background())
+	if err == nil {
+		t.Fatal("request to closed server must fail")
+	}
+	if attempts != 2 {
+		t.Errorf("got %d attempts, want 2", attempts)
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "connection refused", err: &url.Error{Op: "Get", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}, want: true},
+		{name: "connection reset", err: &url.Error{Op: "Get", Err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}}, want: true},
+		{name: "eof", err: &url.Error{Op: "Get", Err: io.EOF}, want: true},
+		{name: "deadline", err: &url.Error{Op: "Get", Err: context.DeadlineExceeded}, want: true},
+		{name: "canceled", err: &url.Error{Op: "Get", Err: context.Canceled}, want: false},
+		{name: "unsupported scheme", err: &url.Error{Op: "Get", Err: errors.New(`unsupported protocol scheme "ftp"`)}, want: false},
+		{name: "redirect policy", err: &url.Error{Op: "Get", Err: errors.New("stopped after 10 redirects")}, want: false},
+		{name: "unknown authority", err: &url.Error{Op: "Get", Err: x509.UnknownAuthorityError{}}, want: false},
+		{name: "hostname", err: &url.Error{Op: "Get", Err: x509.HostnameError{Host: "a"}}, want: false},
+		{name: "tls record header", err: &url.Error{Op: "Get", Err: tls.RecordHeaderError{Msg: "not tls"}}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableError(tt.err); got != tt.want {
+				t.Errorf("isRetryableError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_RetryCertificateError(t *testing.T) {
+	var conns int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	retry := NewRetryPolicy(3)
+	retry.MinBackoff = time.Millisecond
+	// server certificate is signed by unknown CA
+	_, err := NewClient(ts.URL).SetRetryPolicy(retry).NewRenderQuery("", "", []string{"a.b"}, 0).Request(context.Background())
+	var unknownAuthority x509.UnknownAuthorityError
+	if !errors.As(err, &unknownAuthority) {
+		t.Fatalf("Request() error = %v, want x509.UnknownAuthorityError", err)
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("got %d connections, want 1", n)
+	}
+}
+
+func TestRetryPolicy_retryAfterLimit(t *testing.T) {
+	header := http.Header{}
+	tests := []struct {
+		name       string
+		maxBackoff time.Duration
+		retryAfter string
+		want       time.Duration
+		wantRetry  bool
+	}{
+		{name: "exceed max backoff", maxBackoff: 5 * time.Second, retryAfter: "86400"},
+		{name: "exceed default limit", retryAfter: "86400"},
+		{name: "in max backoff", maxBackoff: 5 * time.Second, retryAfter: "2", want: 2 * time.Second, wantRetry: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: tt.maxBackoff}
+			header.Set("Retry-After", tt.retryAfter)
+			got, retry := p.retryBackoff(context.Background(), 1, true, http.StatusTooManyRequests, header, nil)
+			if got != tt.want || retry != tt.wantRetry {
+				t.Errorf("retryBackoff() = %v, %v, want %v, %v", got, retry, tt.want, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestClient_RetryNetworkErrorNotIdempotent(t *testing.T) {
+	var requests int32
+	servers := make([]*httptest.Server, 2)
+	bases := make([]string, len(servers))
+	for i := range servers {
+		// close connection after request is read (server may already process it)
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conn.Close()
+		}))
+		defer servers[i].Close()
+		bases[i] = servers[i].URL
+	}
+
+	tests := []struct {
+		name  string
+		retry *RetryPolicy
+	}{
+		{name: "failover"},
+		{name: "retry policy", retry: &RetryPolicy{MaxAttempts: 3, RetryNetworkErrors: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient("").SetBackends(bases, BalanceRoundRobin)
+			if tt.retry != nil {
+				client.SetRetryPolicy(tt.retry)
+			}
+
+			atomic.StoreInt32(&requests, 0)
+			if _, err := client.NewTagSeriesQuery("a.b;c=d").Request(context.Background()); err == nil {
+				t.Fatal("request must fail")
+			}
+			if n := atomic.LoadInt32(&requests); n != 1 {
+				t.Errorf("POST request sent %d times, want 1", n)
+			}
+
+			atomic.StoreInt32(&requests, 0)
+			if _, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Request(context.Background()); err == nil {
+				t.Fatal("request must fail")
+			}
+			if n := atomic.LoadInt32(&requests); n < 2 {
+				t.Errorf("GET request sent %d times, want retry", n)
+			}
+		})
+	}
+}
+
+func TestIsNotSentError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "connection refused", err: &url.Error{Op: "Post", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}, want: true},
+		{name: "dial timeout", err: &url.Error{Op: "Post", Err: &net.OpError{Op: "dial", Err: context.DeadlineExceeded}}, want: true},
+		{name: "connection reset", err: &url.Error{Op: "Post", Err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}}, want: false},
+		{name: "eof", err: &url.Error{Op: "Post", Err: io.EOF}, want: false},
+		{name: "deadline", err: &url.Error{Op: "Post", Err: context.DeadlineExceeded}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isNotSentError(tt.err); got != tt.want {
+				t.Errorf("isNotSentError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
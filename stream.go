@@ -0,0 +1,348 @@
+package graphiteapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrStreamInvalid is returned by stream decoder for malformed render response
+var ErrStreamInvalid = errors.New("invalid render response")
+
+// streamBufferSize is a read buffer size for stream decoders
+const streamBufferSize = 64 * 1024
+
+// SeriesIterator yields series one at a time from render response body, so memory is bounded by the largest series
+// (for json and protobuf formats, other formats are decoded completely before iteration).
+// Iterator must be closed.
+//
+//	it, err := q.Stream(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	defer it.Close()
+//	for it.Next() {
+//		s := it.Series()
+//		...
+//	}
+//	return it.Err()
+type SeriesIterator struct {
+	body   io.ReadCloser
+	next   func() (Series, error) // returns io.EOF after the last series
+	series Series
+	err    error
+
+	span   trace.Span    // query span, ended on Close, nil if not traced
+	read   *countReader  // response body with read bytes counter
+	count  int           // decoded series
+	decode time.Duration // decode time (with body read)
+}
+
+// Next decodes the next series, returns false at the end of response or on error
+func (it *SeriesIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	start := time.Now()
+	it.series, it.err = it.next()
+	it.decode += time.Since(start)
+	if it.err != nil {
+		return false
+	}
+	it.count++
+	return true
+}
+
+// Series returns the current series
+func (it *SeriesIterator) Series() Series {
+	return it.series
+}
+
+// Err returns decode (or read) error, nil at the end of response
+func (it *SeriesIterator) Err() error {
+	if it.err == io.EOF {
+		return nil
+	}
+	return it.err
+}
+
+// Close closes response body
+func (it *SeriesIterator) Close() error {
+	if it.span != nil {
+		it.span.SetAttributes(
+			attrResponseSize.Int64(it.read.n),
+			attrSeries.Int(it.count),
+			decodeTime(it.decode),
+		)
+		endSpan(it.span, it.Err())
+		it.span = nil
+	}
+	if it.err == nil {
+		it.err = io.EOF
+	}
+	return it.body.Close()
+}
+
+// countReader counts bytes, read from response body
+type countReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// newSeriesIterator returns iterator over render response body in format
+func newSeriesIterator(body io.ReadCloser, format RenderFormat, maxDataPoints int, loc *time.Location) *SeriesIterator {
+	it := &SeriesIterator{body: body}
+	r := bufio.NewReaderSize(body, streamBufferSize)
+	switch format {
+	case RenderFormatJSON:
+		d := &jsonSeriesDecoder{r: r, maxDataPoints: maxDataPoints}
+		it.next = d.next
+	case RenderFormatProtobuf:
+		d := &pbSeriesDecoder{r: r, decode: unmarshallProtobufV2Serie}
+		it.next = d.next
+	case RenderFormatCarbonAPIV3PB:
+		d := &pbSeriesDecoder{r: r, decode: unmarshallProtobufV3Serie}
+		it.next = d.next
+	default:
+		// no stream decoder, decode the whole response
+		var series []Series
+		it.next = func() (Series, error) {
+			if series == nil {
+				data, err := ioutil.ReadAll(r)
+				if err != nil {
+					return Series{}, err
+				}
+				if series, err = format.unmarshallSeries(data, 0, maxDataPoints, loc); err != nil {
+					return Series{}, err
+				}
+			}
+			if len(series) == 0 {
+				return Series{}, io.EOF
+			}
+			s := series[0]
+			series = series[1:]
+			return s, nil
+		}
+	}
+	return it
+}
+
+// jsonSeriesDecoder reads series objects from json array one by one
+type jsonSeriesDecoder struct {
+	r             *bufio.Reader
+	maxDataPoints int
+	started       bool
+	buf           []byte // series object, reused
+}
+
+// skipSpaces returns the next not space byte
+func (d *jsonSeriesDecoder) skipSpaces() (byte, error) {
+	for {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+		default:
+			return c, nil
+		}
+	}
+}
+
+func (d *jsonSeriesDecoder) next() (Series, error) {
+	c, err := d.skipSpaces()
+	if err != nil {
+		if err == io.EOF && !d.started {
+			// empty response
+			return Series{}, io.EOF
+		}
+		return Series{}, unexpectedEOF(err)
+	}
+	if !d.started {
+		if c != '[' {
+			return Series{}, fmt.Errorf("%w: json array expected", ErrStreamInvalid)
+		}
+		d.started = true
+		if c, err = d.skipSpaces(); err != nil {
+			return Series{}, unexpectedEOF(err)
+		}
+	} else if c == ',' {
+		if c, err = d.skipSpaces(); err != nil {
+			return Series{}, unexpectedEOF(err)
+		}
+	} else if c != ']' {
+		return Series{}, fmt.Errorf("%w: unexpected '%c' after series", ErrStreamInvalid, c)
+	}
+	if c == ']' {
+		return Series{}, io.EOF
+	}
+	if c != '{' {
+		return Series{}, fmt.Errorf("%w: unexpected '%c', series object expected", ErrStreamInvalid, c)
+	}
+
+	// read series object
+	d.buf = append(d.buf[:0], c)
+	var (
+		depth    = 1
+		inString bool
+		escaped  bool
+	)
+	for depth > 0 {
+		if c, err = d.r.ReadByte(); err != nil {
+			return Series{}, unexpectedEOF(err)
+		}
+		d.buf = append(d.buf, c)
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+
+	return unmarshallSerie(d.buf, d.maxDataPoints)
+}
+
+// pbSeriesDecoder reads FetchResponse messages from MultiFetchResponse (metrics = 1) one by one
+type pbSeriesDecoder struct {
+	r      *bufio.Reader
+	decode func([]byte) (Series, error)
+	buf    bytes.Buffer // FetchResponse message, reused
+}
+
+// maxPbMessageSize limits length of protobuf message in stream (max message size in protobuf is 2GB)
+const maxPbMessageSize = math.MaxInt32
+
+func (d *pbSeriesDecoder) next() (Series, error) {
+	for {
+		key, err := binary.ReadUvarint(d.r)
+		if err != nil {
+			// io.EOF only at message boundary
+			return Series{}, err
+		}
+		field, wireType := int(key>>3), int(key&7)
+		switch wireType {
+		case pbVarint:
+			if _, err = binary.ReadUvarint(d.r); err != nil {
+				return Series{}, unexpectedEOF(err)
+			}
+		case pbFixed64:
+			if _, err = d.r.Discard(8); err != nil {
+				return Series{}, unexpectedEOF(err)
+			}
+		case pbFixed32:
+			if _, err = d.r.Discard(4); err != nil {
+				return Series{}, unexpectedEOF(err)
+			}
+		case pbBytes:
+			size, err := binary.ReadUvarint(d.r)
+			if err != nil {
+				return Series{}, unexpectedEOF(err)
+			}
+			if size > maxPbMessageSize {
+				return Series{}, ErrProtobufInvalid
+			}
+			if field != 1 {
+				if _, err = d.r.Discard(int(size)); err != nil {
+					return Series{}, unexpectedEOF(err)
+				}
+				continue
+			}
+			// buffer grows with received data, so corrupted length doesn't allocate memory before read fails
+			d.buf.Reset()
+			n, err := d.buf.ReadFrom(io.LimitReader(d.r, int64(size)))
+			if err != nil {
+				return Series{}, err
+			}
+			if uint64(n) < size {
+				return Series{}, io.ErrUnexpectedEOF
+			}
+			return d.decode(d.buf.Bytes())
+		default:
+			return Series{}, ErrProtobufInvalid
+		}
+		if field == 1 {
+			return Series{}, ErrProtobufInvalid
+		}
+	}
+}
+
+// unexpectedEOF replaces io.EOF in the middle of response
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Stream does request and returns iterator over response series, iterator must be closed.
+// Client timeout is applied till response headers, body read is limited by ctx.
+// Query span is ended on iterator Close.
+func (q *RenderQuery) Stream(ctx context.Context) (*SeriesIterator, error) {
+	loc, err := q.decodeLocation()
+	if err != nil {
+		return nil, err
+	}
+
+	client := q.Client()
+	req, err := q.newRequest(client)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, span := client.startSpan(ctx, req.URL.Path, q.spanAttributes()...)
+	format := q.format()
+	body, err := client.httpDoStream(ctx, req, format.contentTypes()...)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+
+	read := &countReader{ReadCloser: body}
+	it := newSeriesIterator(read, format, q.MaxDataPoints, loc)
+	it.span = span
+	it.read = read
+	return it, nil
+}
+
+// RequestEach does request and calls fn for each response series, while fn returns nil
+func (q *RenderQuery) RequestEach(ctx context.Context, fn func(Series) error) error {
+	it, err := q.Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	for it.Next() {
+		if err = fn(it.Series()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
@@ -0,0 +1,218 @@
+package graphiteapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const streamJSONResponse = `[
+	{"target": "main1", "tags": {"name": "main1"}, "datapoints": [[1, 1468339853], [null, 1468339854]]},
+	{"target": "main2 \"quoted\" [x]", "datapoints": [[2.5, 1468339853]]},
+	{"target": "main3", "datapoints": []}
+]`
+
+func TestRenderQuery_Stream(t *testing.T) {
+	tests := []struct {
+		format  RenderFormat
+		fixture string // file in testdata, streamJSONResponse if empty
+		data    string
+	}{
+		{format: RenderFormatJSON, data: streamJSONResponse},
+		{format: RenderFormatJSON, data: " [ ] "},
+		{format: RenderFormatJSON, data: ""},
+		{format: RenderFormatProtobuf, fixture: "render.carbonapi_v2_pb"},
+		{format: RenderFormatCarbonAPIV3PB, fixture: "render.carbonapi_v3_pb"},
+		{format: RenderFormatPickle, fixture: "render_proto2.pickle"},
+		{format: RenderFormatMsgpack, fixture: "render.msgpack"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format)+" "+tt.fixture, func(t *testing.T) {
+			data := []byte(tt.data)
+			if tt.fixture != "" {
+				var err error
+				if data, err = ioutil.ReadFile("testdata/" + tt.fixture); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-type", tt.format.contentType())
+				w.Write(data)
+			}))
+			defer ts.Close()
+
+			q := NewClient("http://"+ts.Listener.Addr().String()).NewRenderQuery("", "", []string{"main*"}, 0).SetFormat(tt.format)
+			want, err := q.Request(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []Series
+			if err = q.RequestEach(context.Background(), func(s Series) error {
+				got = append(got, s)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			compareSeries(t, got, want)
+		})
+	}
+}
+
+func TestRenderQuery_StreamInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  RenderFormat
+		data    string
+		wantErr error
+	}{
+		{name: "truncated json", format: RenderFormatJSON, data: streamJSONResponse[:60], wantErr: io.ErrUnexpectedEOF},
+		{name: "not array", format: RenderFormatJSON, data: `{"target": "a"}`, wantErr: ErrStreamInvalid},
+		{name: "no comma", format: RenderFormatJSON, data: `[{"target": "a", "datapoints": []} {}]`, wantErr: ErrStreamInvalid},
+		{name: "truncated protobuf", format: RenderFormatProtobuf, data: "\x0a\x10abc", wantErr: io.ErrUnexpectedEOF},
+		{name: "protobuf length overflow", format: RenderFormatProtobuf, data: "\x0a\xff\xff\xff\xff\xff\xff\xff\xff\x7f", wantErr: ErrProtobufInvalid},
+		{name: "protobuf skipped length overflow", format: RenderFormatCarbonAPIV3PB, data: "\x12\xff\xff\xff\xff\xff\xff\xff\xff\x7f", wantErr: ErrProtobufInvalid},
+		// 1GB message length, must fail without allocation of message size
+		{name: "protobuf large length", format: RenderFormatCarbonAPIV3PB, data: "\x0a\x80\x80\x80\x80\x04abc", wantErr: io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-type", tt.format.contentType())
+				w.Write([]byte(tt.data))
+			}))
+			defer ts.Close()
+
+			q := NewClient("http://"+ts.Listener.Addr().String()).NewRenderQuery("", "", []string{"main*"}, 0).SetFormat(tt.format)
+			err := q.RequestEach(context.Background(), func(s Series) error { return nil })
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("RequestEach() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// series must be yielded before the whole response is received
+func TestRenderQuery_StreamPartial(t *testing.T) {
+	received := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+		w.Write([]byte(`[{"target": "a", "datapoints": [[1, 1]]},`))
+		w.(http.Flusher).Flush()
+		select {
+		case <-received:
+		case <-time.After(2 * time.Second):
+			t.Error("the first series is not received before the end of response")
+		}
+		w.Write([]byte(`{"target": "b", "datapoints": [[2, 1]]}]`))
+	}))
+	defer ts.Close()
+
+	q := NewClient("http://"+ts.Listener.Addr().String()).NewRenderQuery("", "", []string{"*"}, 0)
+	var targets []string
+	err := q.RequestEach(context.Background(), func(s Series) error {
+		if s.Target == "a" {
+			close(received)
+		}
+		targets = append(targets, s.Target)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(targets, ",") != "a,b" {
+		t.Errorf("targets = %v, want [a b]", targets)
+	}
+}
+
+func TestRenderQuery_StreamStop(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+		w.Write([]byte(streamJSONResponse))
+	}))
+	defer ts.Close()
+
+	stop := errors.New("stop")
+	n := 0
+	q := NewClient("http://"+ts.Listener.Addr().String()).NewRenderQuery("", "", []string{"*"}, 0)
+	err := q.RequestEach(context.Background(), func(s Series) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("RequestEach() = %v after %d series, want %v after 1", err, n, stop)
+	}
+}
+
+// client timeout is applied till response headers, slow consumer can read body longer
+func TestRenderQuery_StreamSlowConsumer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+		// response body is sent in parts, so it's read after consumer processing
+		parts := strings.SplitAfter(streamJSONResponse, "]},")
+		for _, part := range parts {
+			w.Write([]byte(part))
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer ts.Close()
+
+	n := 0
+	q := NewClient("http://"+ts.Listener.Addr().String()).SetTimeout(100*time.Millisecond).NewRenderQuery("", "", []string{"*"}, 0)
+	err := q.RequestEach(context.Background(), func(s Series) error {
+		n++
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	})
+	if err != nil || n != 3 {
+		t.Errorf("RequestEach() = %v after %d series, want nil after 3", err, n)
+	}
+}
+
+func TestRenderQuery_StreamHeadersTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	start := time.Now()
+	q := NewClient("http://"+ts.Listener.Addr().String()).SetTimeout(100*time.Millisecond).NewRenderQuery("", "", []string{"*"}, 0)
+	_, err := q.Stream(context.Background())
+	if !IsTimeout(err) {
+		t.Fatalf("Stream() error = %v, want timeout", err)
+	}
+	if d := time.Since(start); d >= time.Second {
+		t.Errorf("Stream() ended in %v, want timeout", d)
+	}
+}
+
+func TestRenderQuery_StreamHedged(t *testing.T) {
+	backends := newTestBackends(t, 2, []time.Duration{time.Second, 0}, nil)
+	defer closeTestBackends(backends)
+
+	client := NewClient("").SetBackends(testBackendsBases(backends), BalancePriority).
+		SetHedging(&HedgePolicy{Delay: 50 * time.Millisecond})
+	it, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Stream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for it.Next() {
+	}
+	if err = it.Err(); err != nil {
+		t.Errorf("hedged stream error = %v", err)
+	}
+	it.Close()
+	if stats := client.HedgeStats(); stats.Won != 1 {
+		t.Errorf("HedgeStats() = %+v, want hedged request won", stats)
+	}
+}
@@ -0,0 +1,546 @@
+package graphiteapi
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/buger/jsonparser"
+)
+
+var (
+	ErrTagExprInvalid = errors.New("invalid tag expression")
+)
+
+// TagEq returns tag expression `tag=value`
+func TagEq(tag, value string) TagExpr {
+	return TagExpr{Tag: tag, Op: TagOpEq, Value: value}
+}
+
+// TagNe returns tag expression `tag!=value`
+func TagNe(tag, value string) TagExpr {
+	return TagExpr{Tag: tag, Op: TagOpNe, Value: value}
+}
+
+// TagMatch returns tag expression `tag=~regex`
+func TagMatch(tag, regex string) TagExpr {
+	return TagExpr{Tag: tag, Op: TagOpMatch, Value: regex}
+}
+
+// TagNotMatch returns tag expression `tag!=~regex`
+func TagNotMatch(tag, regex string) TagExpr {
+	return TagExpr{Tag: tag, Op: TagOpNotMatch, Value: regex}
+}
+
+// ParseTagExpr parses tag expression string, like `name=~cpu\..*`
+func ParseTagExpr(s string) (TagExpr, error) {
+	n := strings.IndexByte(s, '=')
+	if n < 1 {
+		return TagExpr{}, ErrTagExprInvalid
+	}
+	expr := TagExpr{Op: TagOpEq}
+	end := n + 1
+	if s[n-1] == '!' {
+		expr.Op = TagOpNe
+		n--
+	}
+	if end < len(s) && s[end] == '~' {
+		if expr.Op == TagOpNe {
+			expr.Op = TagOpNotMatch
+		} else {
+			expr.Op = TagOpMatch
+		}
+		end++
+	}
+	expr.Tag = strings.TrimSpace(s[:n])
+	if len(expr.Tag) == 0 {
+		return TagExpr{}, ErrTagExprInvalid
+	}
+	expr.Value = s[end:]
+	return expr, nil
+}
+
+// String returns tag expression in graphite format
+func (e TagExpr) String() string {
+	return e.Tag + string(e.Op) + e.Value
+}
+
+func addTagExprs(v url.Values, exprs []TagExpr) {
+	for _, expr := range exprs {
+		v.Add("expr", expr.String())
+	}
+}
+
+// NewTagsQuery returns a TagsQuery instance, bound to client
+func (c *Client) NewTagsQuery() *TagsQuery {
+	return &TagsQuery{client: c}
+}
+
+// Client returns client, used for requests
+func (q *TagsQuery) Client() *Client {
+	if q.client == nil {
+		return DefaultClient
+	}
+	return q.client
+}
+
+func (q *TagsQuery) SetFilter(filter string) *TagsQuery {
+	q.Filter = filter
+	return q
+}
+
+func (q *TagsQuery) SetLimit(limit int) *TagsQuery {
+	q.Limit = limit
+	return q
+}
+
+// URL returns query url
+func (q *TagsQuery) URL() (*url.URL, error) {
+	u, err := url.Parse(q.Client().Base() + "/tags")
+	if err != nil {
+		return nil, err
+	}
+	v := url.Values{}
+
+	if q.Filter != "" {
+		v.Set("filter", q.Filter)
+	}
+
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+
+	u.RawQuery = v.Encode()
+
+	return u, nil
+}
+
+// Request do `/tags` request and returns tags names
+func (q *TagsQuery) Request(ctx context.Context) (TagNames, error) {
+	var tags TagNames
+	if err := q.Client().request(ctx, q, &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// Unmarshal implements Response interface
+func (t *TagNames) Unmarshal(data []byte) error {
+	tags := TagNames{}
+	var ie error
+	if len(data) > 0 {
+		_, err := jsonparser.ArrayEach(data, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+			if err != nil || ie != nil {
+				return
+			}
+			tag, e := jsonparser.GetString(value, "tag")
+			if e != nil {
+				ie = e
+				return
+			}
+			tags = append(tags, tag)
+		})
+		if err != nil {
+			return err
+		}
+		if ie != nil {
+			return ie
+		}
+	}
+	*t = tags
+	return nil
+}
+
+// NewTagValuesQuery returns a TagValuesQuery instance, bound to client
+func (c *Client) NewTagValuesQuery(tag string) *TagValuesQuery {
+	return &TagValuesQuery{Tag: tag, client: c}
+}
+
+// Client returns client, used for requests
+func (q *TagValuesQuery) Client() *Client {
+	if q.client == nil {
+		return DefaultClient
+	}
+	return q.client
+}
+
+func (q *TagValuesQuery) SetFilter(filter string) *TagValuesQuery {
+	q.Filter = filter
+	return q
+}
+
+func (q *TagValuesQuery) SetLimit(limit int) *TagValuesQuery {
+	q.Limit = limit
+	return q
+}
+
+// URL returns query url
+func (q *TagValuesQuery) URL() (*url.URL, error) {
+	u, err := url.Parse(q.Client().Base() + "/tags/" + url.PathEscape(q.Tag))
+	if err != nil {
+		return nil, err
+	}
+	v := url.Values{}
+
+	if q.Filter != "" {
+		v.Set("filter", q.Filter)
+	}
+
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+
+	u.RawQuery = v.Encode()
+
+	return u, nil
+}
+
+// Request do `/tags/<tag>` request and returns tag values
+func (q *TagValuesQuery) Request(ctx context.Context) (*TagValues, error) {
+	values := &TagValues{}
+	if err := q.Client().request(ctx, q, values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Unmarshal implements Response interface
+func (t *TagValues) Unmarshal(data []byte) error {
+	var (
+		tag    string
+		values = []TagValue{}
+		ie     error
+	)
+	if len(data) > 0 {
+		var err error
+		if tag, err = jsonparser.GetString(data, "tag"); err != nil {
+			return err
+		}
+		_, err = jsonparser.ArrayEach(data, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+			if err != nil || ie != nil {
+				return
+			}
+			var v TagValue
+			if v.Value, ie = jsonparser.GetString(value, "value"); ie != nil {
+				return
+			}
+			count, e := jsonparser.GetInt(value, "count")
+			if e != nil {
+				ie = e
+				return
+			}
+			v.Count = int(count)
+			values = append(values, v)
+		}, "values")
+		if err != nil {
+			return err
+		}
+		if ie != nil {
+			return ie
+		}
+	}
+	t.Tag = tag
+	t.Values = values
+	return nil
+}
+
+// NewFindSeriesQuery returns a FindSeriesQuery instance, bound to client
+func (c *Client) NewFindSeriesQuery(exprs ...TagExpr) *FindSeriesQuery {
+	return &FindSeriesQuery{Exprs: exprs, client: c}
+}
+
+// Client returns client, used for requests
+func (q *FindSeriesQuery) Client() *Client {
+	if q.client == nil {
+		return DefaultClient
+	}
+	return q.client
+}
+
+func (q *FindSeriesQuery) AddExpr(expr TagExpr) *FindSeriesQuery {
+	q.Exprs = append(q.Exprs, expr)
+	return q
+}
+
+// URL returns query url
+func (q *FindSeriesQuery) URL() (*url.URL, error) {
+	u, err := url.Parse(q.Client().Base() + "/tags/findSeries")
+	if err != nil {
+		return nil, err
+	}
+	v := url.Values{}
+
+	addTagExprs(v, q.Exprs)
+
+	u.RawQuery = v.Encode()
+
+	return u, nil
+}
+
+// Request do `/tags/findSeries` request and returns found series
+func (q *FindSeriesQuery) Request(ctx context.Context) (TaggedSeries, error) {
+	var series TaggedSeries
+	if err := q.Client().request(ctx, q, &series); err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// Unmarshal implements Response interface
+func (s *TaggedSeries) Unmarshal(data []byte) error {
+	series, err := unmarshallStrings(data)
+	if err != nil {
+		return err
+	}
+	*s = series
+	return nil
+}
+
+// NewAutoCompleteTagsQuery returns a AutoCompleteTagsQuery instance, bound to client
+func (c *Client) NewAutoCompleteTagsQuery(tagPrefix string, exprs ...TagExpr) *AutoCompleteTagsQuery {
+	return &AutoCompleteTagsQuery{TagPrefix: tagPrefix, Exprs: exprs, client: c}
+}
+
+// Client returns client, used for requests
+func (q *AutoCompleteTagsQuery) Client() *Client {
+	if q.client == nil {
+		return DefaultClient
+	}
+	return q.client
+}
+
+func (q *AutoCompleteTagsQuery) AddExpr(expr TagExpr) *AutoCompleteTagsQuery {
+	q.Exprs = append(q.Exprs, expr)
+	return q
+}
+
+func (q *AutoCompleteTagsQuery) SetLimit(limit int) *AutoCompleteTagsQuery {
+	q.Limit = limit
+	return q
+}
+
+// URL returns query url
+func (q *AutoCompleteTagsQuery) URL() (*url.URL, error) {
+	u, err := url.Parse(q.Client().Base() + "/tags/autoComplete/tags")
+	if err != nil {
+		return nil, err
+	}
+	v := url.Values{}
+
+	if q.TagPrefix != "" {
+		v.Set("tagPrefix", q.TagPrefix)
+	}
+
+	addTagExprs(v, q.Exprs)
+
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+
+	u.RawQuery = v.Encode()
+
+	return u, nil
+}
+
+// Request do `/tags/autoComplete/tags` request and returns tags names
+func (q *AutoCompleteTagsQuery) Request(ctx context.Context) (AutoComplete, error) {
+	var result AutoComplete
+	if err := q.Client().request(ctx, q, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// NewAutoCompleteValuesQuery returns a AutoCompleteValuesQuery instance, bound to client
+func (c *Client) NewAutoCompleteValuesQuery(tag, valuePrefix string, exprs ...TagExpr) *AutoCompleteValuesQuery {
+	return &AutoCompleteValuesQuery{Tag: tag, ValuePrefix: valuePrefix, Exprs: exprs, client: c}
+}
+
+// Client returns client, used for requests
+func (q *AutoCompleteValuesQuery) Client() *Client {
+	if q.client == nil {
+		return DefaultClient
+	}
+	return q.client
+}
+
+func (q *AutoCompleteValuesQuery) AddExpr(expr TagExpr) *AutoCompleteValuesQuery {
+	q.Exprs = append(q.Exprs, expr)
+	return q
+}
+
+func (q *AutoCompleteValuesQuery) SetLimit(limit int) *AutoCompleteValuesQuery {
+	q.Limit = limit
+	return q
+}
+
+// URL returns query url
+func (q *AutoCompleteValuesQuery) URL() (*url.URL, error) {
+	u, err := url.Parse(q.Client().Base() + "/tags/autoComplete/values")
+	if err != nil {
+		return nil, err
+	}
+	v := url.Values{}
+
+	v.Set("tag", q.Tag)
+
+	if q.ValuePrefix != "" {
+		v.Set("valuePrefix", q.ValuePrefix)
+	}
+
+	addTagExprs(v, q.Exprs)
+
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+
+	u.RawQuery = v.Encode()
+
+	return u, nil
+}
+
+// Request do `/tags/autoComplete/values` request and returns tag values
+func (q *AutoCompleteValuesQuery) Request(ctx context.Context) (AutoComplete, error) {
+	var result AutoComplete
+	if err := q.Client().request(ctx, q, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Unmarshal implements Response interface
+func (a *AutoComplete) Unmarshal(data []byte) error {
+	result, err := unmarshallStrings(data)
+	if err != nil {
+		return err
+	}
+	*a = result
+	return nil
+}
+
+// NewTagSeriesQuery returns a TagSeriesQuery instance, bound to client
+func (c *Client) NewTagSeriesQuery(path string) *TagSeriesQuery {
+	return &TagSeriesQuery{Path: path, client: c}
+}
+
+// Client returns client, used for requests
+func (q *TagSeriesQuery) Client() *Client {
+	if q.client == nil {
+		return DefaultClient
+	}
+	return q.client
+}
+
+// URL returns query url
+func (q *TagSeriesQuery) URL() (*url.URL, error) {
+	return url.Parse(q.Client().Base() + "/tags/tagSeries")
+}
+
+// Request do `/tags/tagSeries` request and returns canonical path of series
+func (q *TagSeriesQuery) Request(ctx context.Context) (string, error) {
+	var path stringResponse
+	if err := q.Client().requestForm(ctx, q, url.Values{"path": {q.Path}}, &path); err != nil {
+		return "", err
+	}
+	return string(path), nil
+}
+
+// NewTagMultiSeriesQuery returns a TagMultiSeriesQuery instance, bound to client
+func (c *Client) NewTagMultiSeriesQuery(paths []string) *TagMultiSeriesQuery {
+	return &TagMultiSeriesQuery{Paths: paths, client: c}
+}
+
+// Client returns client, used for requests
+func (q *TagMultiSeriesQuery) Client() *Client {
+	if q.client == nil {
+		return DefaultClient
+	}
+	return q.client
+}
+
+func (q *TagMultiSeriesQuery) AddPath(path string) *TagMultiSeriesQuery {
+	q.Paths = append(q.Paths, path)
+	return q
+}
+
+// URL returns query url
+func (q *TagMultiSeriesQuery) URL() (*url.URL, error) {
+	return url.Parse(q.Client().Base() + "/tags/tagMultiSeries")
+}
+
+// Request do `/tags/tagMultiSeries` request and returns canonical paths of series
+func (q *TagMultiSeriesQuery) Request(ctx context.Context) (TaggedSeries, error) {
+	var series TaggedSeries
+	if err := q.Client().requestForm(ctx, q, url.Values{"path": q.Paths}, &series); err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// NewDelSeriesQuery returns a DelSeriesQuery instance, bound to client
+func (c *Client) NewDelSeriesQuery(paths []string) *DelSeriesQuery {
+	return &DelSeriesQuery{Paths: paths, client: c}
+}
+
+// Client returns client, used for requests
+func (q *DelSeriesQuery) Client() *Client {
+	if q.client == nil {
+		return DefaultClient
+	}
+	return q.client
+}
+
+func (q *DelSeriesQuery) AddPath(path string) *DelSeriesQuery {
+	q.Paths = append(q.Paths, path)
+	return q
+}
+
+// URL returns query url
+func (q *DelSeriesQuery) URL() (*url.URL, error) {
+	return url.Parse(q.Client().Base() + "/tags/delSeries")
+}
+
+// Request do `/tags/delSeries` request and returns true, if series are deleted
+func (q *DelSeriesQuery) Request(ctx context.Context) (bool, error) {
+	var ok boolResponse
+	if err := q.Client().requestForm(ctx, q, url.Values{"path": q.Paths}, &ok); err != nil {
+		return false, err
+	}
+	return bool(ok), nil
+}
+
+// stringResponse is a single json string response
+type stringResponse string
+
+// Unmarshal implements Response interface
+func (s *stringResponse) Unmarshal(data []byte) error {
+	if len(data) == 0 {
+		*s = ""
+		return nil
+	}
+	v, err := jsonparser.GetString(data)
+	if err != nil {
+		return err
+	}
+	*s = stringResponse(v)
+	return nil
+}
+
+// boolResponse is a single json bool response
+type boolResponse bool
+
+// Unmarshal implements Response interface
+func (b *boolResponse) Unmarshal(data []byte) error {
+	if len(data) == 0 {
+		*b = false
+		return nil
+	}
+	v, err := jsonparser.GetBoolean(data)
+	if err != nil {
+		return err
+	}
+	*b = boolResponse(v)
+	return nil
+}
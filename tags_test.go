@@ -0,0 +1,163 @@
+package graphiteapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseTagExpr(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    TagExpr
+		wantErr bool
+	}{
+		{expr: "name=cpu.load", want: TagEq("name", "cpu.load")},
+		{expr: "dc!=dc1", want: TagNe("dc", "dc1")},
+		{expr: `name=~cpu\..*`, want: TagMatch("name", `cpu\..*`)},
+		{expr: "dc!=~dc[12]", want: TagNotMatch("dc", "dc[12]")},
+		{expr: "dc=", want: TagEq("dc", "")},
+		{expr: "=dc1", wantErr: true},
+		{expr: "!=dc1", wantErr: true},
+		{expr: "dc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := ParseTagExpr(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTagExpr() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseTagExpr() = %+v, want %+v", got, tt.want)
+			}
+			if !tt.wantErr && got.String() != tt.expr {
+				t.Errorf("TagExpr.String() = %s, want %s", got.String(), tt.expr)
+			}
+		})
+	}
+}
+
+func TestFindSeriesQuery_URL(t *testing.T) {
+	q := NewClient("http://domain.tld").NewFindSeriesQuery(TagEq("name", "cpu"), TagNotMatch("dc", "dc[12]"))
+	shouldUrl := "http://domain.tld/tags/findSeries?expr=name%3Dcpu&expr=dc%21%3D~dc%5B12%5D"
+	url, err := q.URL()
+	if err != nil {
+		t.Fatalf("Resulting URL is nil, error is '%v'", err)
+	}
+	gotUrl := url.String()
+	if shouldUrl != gotUrl {
+		t.Errorf("Resulting URL is %v, \n but should be %v", gotUrl, shouldUrl)
+	}
+}
+
+func TestTagsQueries_Request(t *testing.T) {
+	ts := makeJSONServer(t, "/tags", "filter=^d&limit=2", `[{"tag": "dc"}, {"tag": "disk"}]`)
+	defer ts.Close()
+	client := NewClient("http://" + ts.Listener.Addr().String())
+
+	tags, err := client.NewTagsQuery().SetFilter("^d").SetLimit(2).Request(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (TagNames{"dc", "disk"}); !reflect.DeepEqual(tags, want) {
+		t.Errorf("- %+v\n+ %+v", want, tags)
+	}
+
+	ts = makeJSONServer(t, "/tags/dc", "", `{"tag": "dc", "values": [{"count": 2, "value": "dc1"}, {"count": 1, "value": "dc2"}]}`)
+	defer ts.Close()
+	client = NewClient("http://" + ts.Listener.Addr().String())
+
+	values, err := client.NewTagValuesQuery("dc").Request(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantValues := &TagValues{Tag: "dc", Values: []TagValue{{Value: "dc1", Count: 2}, {Value: "dc2", Count: 1}}}
+	if !reflect.DeepEqual(values, wantValues) {
+		t.Errorf("- %+v\n+ %+v", wantValues, values)
+	}
+
+	ts = makeJSONServer(t, "/tags/findSeries", "expr=name=cpu&expr=dc!=dc1", `["cpu;dc=dc2", "cpu;dc=dc3"]`)
+	defer ts.Close()
+	client = NewClient("http://" + ts.Listener.Addr().String())
+
+	series, err := client.NewFindSeriesQuery(TagEq("name", "cpu")).AddExpr(TagNe("dc", "dc1")).Request(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (TaggedSeries{"cpu;dc=dc2", "cpu;dc=dc3"}); !reflect.DeepEqual(series, want) {
+		t.Errorf("- %+v\n+ %+v", want, series)
+	}
+
+	ts = makeJSONServer(t, "/tags/autoComplete/values", "tag=dc&valuePrefix=d&expr=name=cpu", `["dc2", "dc3"]`)
+	defer ts.Close()
+	client = NewClient("http://" + ts.Listener.Addr().String())
+
+	autoComplete, err := client.NewAutoCompleteValuesQuery("dc", "d", TagEq("name", "cpu")).Request(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (AutoComplete{"dc2", "dc3"}); !reflect.DeepEqual(autoComplete, want) {
+		t.Errorf("- %+v\n+ %+v", want, autoComplete)
+	}
+}
+
+func makeFormServer(t *testing.T, path string, expectedForm url.Values, result string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("Method should be POST but %s found", r.Method)
+		}
+		if r.URL.Path != path {
+			t.Errorf("Path should be `%s` but %s found", path, r.URL.Path)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(r.PostForm, expectedForm) {
+			t.Errorf("Expected form is %+v but %+v got", expectedForm, r.PostForm)
+		}
+		w.Header().Set("Content-type", "application/json")
+		fmt.Fprintln(w, result)
+	}))
+}
+
+func TestTagSeriesQueries_Request(t *testing.T) {
+	ts := makeFormServer(t, "/tags/tagSeries", url.Values{"path": {"cpu;dc=dc1;rack=a1"}}, `"cpu;dc=dc1;rack=a1"`)
+	defer ts.Close()
+	client := NewClient("http://" + ts.Listener.Addr().String())
+
+	path, err := client.NewTagSeriesQuery("cpu;dc=dc1;rack=a1").Request(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "cpu;dc=dc1;rack=a1" {
+		t.Errorf("got %s", path)
+	}
+
+	ts = makeFormServer(t, "/tags/tagMultiSeries", url.Values{"path": {"cpu;dc=dc1", "cpu;dc=dc2"}}, `["cpu;dc=dc1", "cpu;dc=dc2"]`)
+	defer ts.Close()
+	client = NewClient("http://" + ts.Listener.Addr().String())
+
+	series, err := client.NewTagMultiSeriesQuery([]string{"cpu;dc=dc1"}).AddPath("cpu;dc=dc2").Request(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (TaggedSeries{"cpu;dc=dc1", "cpu;dc=dc2"}); !reflect.DeepEqual(series, want) {
+		t.Errorf("- %+v\n+ %+v", want, series)
+	}
+
+	ts = makeFormServer(t, "/tags/delSeries", url.Values{"path": {"cpu;dc=dc1"}}, `true`)
+	defer ts.Close()
+	client = NewClient("http://" + ts.Listener.Addr().String())
+
+	ok, err := client.NewDelSeriesQuery([]string{"cpu;dc=dc1"}).Request(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("series not deleted")
+	}
+}
@@ -0,0 +1,181 @@
+package graphiteapi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTLSCA is returned, if CA bundle has no valid certificates
+	ErrTLSCA = errors.New("no certificates found in CA bundle")
+	// ErrTLSVersion is returned for unsupported TLS version
+	ErrTLSVersion = errors.New("unsupported TLS version")
+	// ErrTLSKeyPair is returned, if only one of client certificate and key is set
+	ErrTLSKeyPair = errors.New("both client certificate and key must be set")
+)
+
+// TLSOptions is a TLS configuration for graphite server connections (mutual TLS, custom CA)
+type TLSOptions struct {
+	CAFile             string        // PEM CA bundle for server verification, system roots if not set
+	CertFile           string        // PEM client certificate (for mutual TLS)
+	KeyFile            string        // PEM client key (for mutual TLS)
+	ServerName         string        // server name override for verification and SNI
+	MinVersion         uint16        // min TLS version (like tls.VersionTLS12), TLS 1.2 if not set
+	InsecureSkipVerify bool          // don't verify server certificate (for testing only)
+	ReloadInterval     time.Duration // check client certificate files for changes at most once per interval, 0 disables reload
+}
+
+// ParseTLSVersion parses TLS version (1.0, 1.1, 1.2 or 1.3), empty version is 0 (default)
+func ParseTLSVersion(s string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(s), "tls") {
+	case "":
+		return 0, nil
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrTLSVersion, s)
+	}
+}
+
+// NewTLSConfig returns tls.Config for options (CA bundle and client certificate are loaded from files)
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         opts.ServerName,
+		MinVersion:         opts.MinVersion,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+	if cfg.MinVersion == 0 {
+		cfg.MinVersion = tls.VersionTLS12
+	}
+
+	if opts.CAFile != "" {
+		pem, err := ioutil.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: %s", ErrTLSCA, opts.CAFile)
+		}
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		if opts.CertFile == "" || opts.KeyFile == "" {
+			return nil, ErrTLSKeyPair
+		}
+		r := &certReloader{certFile: opts.CertFile, keyFile: opts.KeyFile, interval: opts.ReloadInterval}
+		if err := r.load(); err != nil {
+			return nil, err
+		}
+		if opts.ReloadInterval > 0 {
+			cfg.GetClientCertificate = r.getClientCertificate
+		} else {
+			cfg.Certificates = []tls.Certificate{*r.cert}
+		}
+	}
+
+	return cfg, nil
+}
+
+// certReloader reloads client certificate, if certificate or key file is modified
+type certReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+	checked time.Time
+}
+
+// modTimes returns modification times of certificate and key files
+func (r *certReloader) modTimes() (certMod, keyMod time.Time, err error) {
+	fi, err := os.Stat(r.certFile)
+	if err != nil {
+		return
+	}
+	certMod = fi.ModTime()
+	if fi, err = os.Stat(r.keyFile); err != nil {
+		return
+	}
+	keyMod = fi.ModTime()
+	return
+}
+
+// load loads certificate and key files (under lock or before use)
+func (r *certReloader) load() error {
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.certMod, r.keyMod = certMod, keyMod
+	r.checked = time.Now()
+	return nil
+}
+
+func (r *certReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.checked) < r.interval {
+		return r.cert, nil
+	}
+	r.checked = now
+	certMod, keyMod, err := r.modTimes()
+	if err != nil || (certMod.Equal(r.certMod) && keyMod.Equal(r.keyMod)) {
+		// keep previous certificate, if files are temporary unavailable
+		return r.cert, nil
+	}
+	// on error (for example, certificate and key are partially replaced) keep previous certificate and retry later
+	_ = r.load()
+	return r.cert, nil
+}
+
+// SetTLSConfig sets TLS config for http client transport (transport, not based on http.Transport, is replaced).
+// Use NewTLSConfig for build config from TLSOptions.
+func (c *Client) SetTLSConfig(cfg *tls.Config) *Client {
+	c.mu.Lock()
+	var transport *http.Transport
+	if t, ok := c.httpClient.Transport.(*http.Transport); ok {
+		transport = t.Clone()
+	} else {
+		transport = newHTTPClient().Transport.(*http.Transport)
+	}
+	transport.TLSClientConfig = cfg
+	httpClient := *c.httpClient
+	httpClient.Transport = transport
+	c.httpClient = &httpClient
+	c.mu.Unlock()
+	return c
+}
+
+// SetTLS sets TLS options for http client transport (see SetTLSConfig)
+func (c *Client) SetTLS(opts TLSOptions) (*Client, error) {
+	cfg, err := NewTLSConfig(opts)
+	if err != nil {
+		return c, err
+	}
+	return c.SetTLSConfig(cfg), nil
+}
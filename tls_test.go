@@ -0,0 +1,288 @@
+package graphiteapi
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA is a CA for issue test certificates
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns PEM certificate and key, signed by CA
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeTestFile(t *testing.T, path string, data []byte, mod time.Time) {
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newMTLSServer returns render server with certificate for name, which requires client certificate, signed by ca.
+// Response target is a client certificate common name.
+func newMTLSServer(t *testing.T, ca *testCA, name string) *httptest.Server {
+	certPEM, keyPEM := ca.issue(t, name, x509.ExtKeyUsageServerAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// new connection for each request (for certificate reload)
+		w.Header().Set("Connection", "close")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"target": "` + r.TLS.PeerCertificates[0].Subject.CommonName + `", "datapoints": [[1, 1468339853]]}]`))
+	}))
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.StartTLS()
+	return ts
+}
+
+func TestClient_TLS(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+	ts := newMTLSServer(t, ca, "graphite.local")
+	defer ts.Close()
+
+	dir := t.TempDir()
+	now := time.Now()
+	writeTestFile(t, filepath.Join(dir, "ca.pem"), ca.pem, now)
+	writeTestFile(t, filepath.Join(dir, "other-ca.pem"), otherCA.pem, now)
+	writeTestFile(t, filepath.Join(dir, "empty.pem"), nil, now)
+	certPEM, keyPEM := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	writeTestFile(t, filepath.Join(dir, "client.pem"), certPEM, now)
+	writeTestFile(t, filepath.Join(dir, "client-key.pem"), keyPEM, now)
+	certPEM, keyPEM = otherCA.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	writeTestFile(t, filepath.Join(dir, "other.pem"), certPEM, now)
+	writeTestFile(t, filepath.Join(dir, "other-key.pem"), keyPEM, now)
+
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	tests := []struct {
+		name       string
+		opts       TLSOptions
+		wantErr    error // NewTLSConfig error
+		wantReqErr bool
+	}{
+		{
+			name: "mtls",
+			opts: TLSOptions{CAFile: "ca.pem", CertFile: "client.pem", KeyFile: "client-key.pem", ServerName: "graphite.local"},
+		},
+		{
+			name: "tls 1.3",
+			opts: TLSOptions{
+				CAFile: "ca.pem", CertFile: "client.pem", KeyFile: "client-key.pem", ServerName: "graphite.local",
+				MinVersion: tls.VersionTLS13,
+			},
+		},
+		{
+			name:       "without client certificate",
+			opts:       TLSOptions{CAFile: "ca.pem", ServerName: "graphite.local"},
+			wantReqErr: true,
+		},
+		{
+			name:       "unknown client certificate",
+			opts:       TLSOptions{CAFile: "ca.pem", CertFile: "other.pem", KeyFile: "other-key.pem", ServerName: "graphite.local"},
+			wantReqErr: true,
+		},
+		{
+			name:       "unknown CA",
+			opts:       TLSOptions{CAFile: "other-ca.pem", CertFile: "client.pem", KeyFile: "client-key.pem", ServerName: "graphite.local"},
+			wantReqErr: true,
+		},
+		{
+			name:       "server name mismatch",
+			opts:       TLSOptions{CAFile: "ca.pem", CertFile: "client.pem", KeyFile: "client-key.pem", ServerName: "graphite.remote"},
+			wantReqErr: true,
+		},
+		{
+			name:    "empty CA",
+			opts:    TLSOptions{CAFile: "empty.pem"},
+			wantErr: ErrTLSCA,
+		},
+		{
+			name:    "without key",
+			opts:    TLSOptions{CAFile: "ca.pem", CertFile: "client.pem"},
+			wantErr: ErrTLSKeyPair,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, f := range []*string{&tt.opts.CAFile, &tt.opts.CertFile, &tt.opts.KeyFile} {
+				if *f != "" {
+					*f = filepath.Join(dir, *f)
+				}
+			}
+			client, err := NewClient("https://127.0.0.1:" + port).SetTLS(tt.opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SetTLS() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			res, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Request(context.Background())
+			if (err != nil) != tt.wantReqErr {
+				t.Fatalf("Request() error = %v, want error %v", err, tt.wantReqErr)
+			}
+			if err == nil && (len(res) != 1 || res[0].Target != "client") {
+				t.Fatalf("Request() = %+v, want client certificate name", res)
+			}
+		})
+	}
+}
+
+func TestClient_TLSReload(t *testing.T) {
+	ca := newTestCA(t)
+	ts := newMTLSServer(t, ca, "graphite.local")
+	defer ts.Close()
+
+	dir := t.TempDir()
+	opts := TLSOptions{
+		CAFile:         filepath.Join(dir, "ca.pem"),
+		CertFile:       filepath.Join(dir, "client.pem"),
+		KeyFile:        filepath.Join(dir, "client-key.pem"),
+		ServerName:     "graphite.local",
+		ReloadInterval: time.Nanosecond,
+	}
+	now := time.Now().Add(-time.Minute)
+	writeTestFile(t, opts.CAFile, ca.pem, now)
+	certPEM, keyPEM := ca.issue(t, "client-1", x509.ExtKeyUsageClientAuth)
+	writeTestFile(t, opts.CertFile, certPEM, now)
+	writeTestFile(t, opts.KeyFile, keyPEM, now)
+
+	client, err := NewClient("https://" + ts.Listener.Addr().String()).SetTLS(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func() string {
+		t.Helper()
+		res, err := client.NewRenderQuery("", "", []string{"a.b"}, 0).Request(context.Background())
+		if err != nil {
+			t.Fatalf("Request() error = %v", err)
+		}
+		return res[0].Target
+	}
+	if got := request(); got != "client-1" {
+		t.Fatalf("client certificate = %q, want client-1", got)
+	}
+
+	// partially replaced (certificate and key mismatch), previous certificate is used
+	certPEM, keyPEM = ca.issue(t, "client-2", x509.ExtKeyUsageClientAuth)
+	writeTestFile(t, opts.CertFile, certPEM, now.Add(time.Second))
+	if got := request(); got != "client-1" {
+		t.Fatalf("client certificate = %q, want client-1", got)
+	}
+
+	writeTestFile(t, opts.KeyFile, keyPEM, now.Add(time.Second))
+	if got := request(); got != "client-2" {
+		t.Fatalf("client certificate = %q, want reloaded client-2", got)
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    uint16
+		wantErr bool
+	}{
+		{s: "", want: 0},
+		{s: "1.2", want: tls.VersionTLS12},
+		{s: "1.3", want: tls.VersionTLS13},
+		{s: "TLS1.1", want: tls.VersionTLS11},
+		{s: "tls10", want: tls.VersionTLS10},
+		{s: "2.0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseTLSVersion(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTLSVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseTLSVersion() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package graphiteapi
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is an instrumentation name for OpenTelemetry tracer
+const tracerName = "github.com/msaf1980/graphite-api-client"
+
+// span attributes
+const (
+	attrEndpoint      = attribute.Key("graphite.endpoint")
+	attrTargets       = attribute.Key("graphite.targets.count")
+	attrFrom          = attribute.Key("graphite.from")
+	attrUntil         = attribute.Key("graphite.until")
+	attrFormat        = attribute.Key("graphite.format")
+	attrMaxDataPoints = attribute.Key("graphite.max_data_points")
+	attrResponseSize  = attribute.Key("graphite.response.size")
+	attrSeries        = attribute.Key("graphite.series.count")
+	attrDecodeTime    = attribute.Key("graphite.decode.duration_ms")
+	attrBackend       = attribute.Key("graphite.backend")
+
+	attrHTTPMethod       = attribute.Key("http.method")
+	attrHTTPURL          = attribute.Key("http.url")
+	attrHTTPStatusCode   = attribute.Key("http.status_code")
+	attrHTTPResponseSize = attribute.Key("http.response_content_length")
+)
+
+// SetTracerProvider sets OpenTelemetry tracer provider for client spans, nil for global provider (otel.GetTracerProvider)
+func (c *Client) SetTracerProvider(provider trace.TracerProvider) *Client {
+	c.mu.Lock()
+	c.tracerProvider = provider
+	c.mu.Unlock()
+	return c
+}
+
+// SetPropagator sets propagator for trace context headers, nil for global propagator (otel.GetTextMapPropagator)
+func (c *Client) SetPropagator(propagator propagation.TextMapPropagator) *Client {
+	c.mu.Lock()
+	c.propagator = propagator
+	c.mu.Unlock()
+	return c
+}
+
+// newTracer returns tracer from provider (or global provider, if nil)
+func newTracer(provider trace.TracerProvider) trace.Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+// newPropagator returns propagator (or global propagator, if nil)
+func newPropagator(propagator propagation.TextMapPropagator) propagation.TextMapPropagator {
+	if propagator == nil {
+		return otel.GetTextMapPropagator()
+	}
+	return propagator
+}
+
+// tracer returns tracer from client tracer provider
+func (c *Client) tracer() trace.Tracer {
+	c.mu.RLock()
+	provider := c.tracerProvider
+	c.mu.RUnlock()
+	return newTracer(provider)
+}
+
+// startSpan starts query span for endpoint
+func (c *Client) startSpan(ctx context.Context, endpoint string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attrEndpoint.String(endpoint))
+	return c.tracer().Start(ctx, "graphite "+endpoint, trace.WithAttributes(attrs...))
+}
+
+// spanAttributes returns span attributes for render query
+func (q *RenderQuery) spanAttributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attrTargets.Int(len(q.Targets)),
+		attrFrom.String(q.From),
+		attrUntil.String(q.Until),
+		attrFormat.String(string(q.format())),
+		attrMaxDataPoints.Int(q.MaxDataPoints),
+	}
+}
+
+// endSpan records error (if not nil) and ends span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// decodeTime returns span attribute for decode duration
+func decodeTime(d time.Duration) attribute.KeyValue {
+	return attrDecodeTime.Float64(float64(d) / float64(time.Millisecond))
+}
+
+// startAttemptSpan starts client span for request attempt and injects trace context into request headers
+func startAttemptSpan(ctx context.Context, opts *attemptOptions, req *http.Request) (context.Context, trace.Span) {
+	ctx, span := opts.tracer.Start(ctx, "HTTP "+req.Method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attrHTTPMethod.String(req.Method),
+			attrHTTPURL.String(req.URL.Redacted()),
+			attrBackend.String(req.URL.Host),
+		),
+	)
+	opts.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return ctx, span
+}
+
+// endAttemptSpan sets attempt result attributes and ends span
+func endAttemptSpan(span trace.Span, res *attemptResult) {
+	if res.statusCode != 0 {
+		span.SetAttributes(attrHTTPStatusCode.Int(res.statusCode))
+	}
+	if res.data != nil {
+		span.SetAttributes(attrHTTPResponseSize.Int(len(res.data)))
+	}
+	endSpan(span, res.err)
+}
@@ -0,0 +1,182 @@
+package graphiteapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+// newTracingServer returns render server, which records traceparent headers
+func newTracingServer(statuses ...int) (*httptest.Server, *[]string) {
+	var traceparents []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+		if n := len(traceparents); n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"target": "a.b", "datapoints": [[1, 1468339853]]}, {"target": "a.c", "datapoints": [[2, 1468339853]]}]`))
+	}))
+	return ts, &traceparents
+}
+
+func TestClient_Tracing(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int // statuses before success
+		retry        int
+		stream       bool
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "request", wantAttempts: 1},
+		{name: "stream", stream: true, wantAttempts: 1},
+		{name: "retry", statuses: []int{http.StatusBadGateway}, retry: 2, wantAttempts: 2},
+		{name: "error", statuses: []int{http.StatusBadGateway}, wantAttempts: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, traceparents := newTracingServer(tt.statuses...)
+			defer ts.Close()
+
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			client := NewClient("http://" + ts.Listener.Addr().String()).
+				SetTracerProvider(provider).
+				SetPropagator(propagation.TraceContext{})
+			if tt.retry > 0 {
+				retry := NewRetryPolicy(tt.retry)
+				retry.MinBackoff = time.Millisecond
+				client.SetRetryPolicy(retry)
+			}
+
+			ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+			q := client.NewRenderQuery("-1h", "now", []string{"a.b", "a.c"}, 100)
+			var err error
+			if tt.stream {
+				err = q.RequestEach(ctx, func(Series) error { return nil })
+			} else {
+				_, err = q.Request(ctx)
+			}
+			parent.End()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Request() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			spans := recorder.Ended()
+			var (
+				query    sdktrace.ReadOnlySpan
+				attempts []sdktrace.ReadOnlySpan
+			)
+			for _, span := range spans {
+				switch span.Name() {
+				case "graphite /render/":
+					query = span
+				case "HTTP GET":
+					attempts = append(attempts, span)
+				}
+			}
+			if query == nil {
+				t.Fatalf("render span not found in %d spans", len(spans))
+			}
+			if query.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Errorf("render span parent = %s, want %s", query.Parent().SpanID(), parent.SpanContext().SpanID())
+			}
+			if len(attempts) != tt.wantAttempts || len(*traceparents) != tt.wantAttempts {
+				t.Fatalf("got %d attempt spans and %d requests, want %d", len(attempts), len(*traceparents), tt.wantAttempts)
+			}
+			for i, attempt := range attempts {
+				if attempt.Parent().SpanID() != query.SpanContext().SpanID() {
+					t.Errorf("attempt %d span parent = %s, want render span", i, attempt.Parent().SpanID())
+				}
+				if attempt.SpanKind() != trace.SpanKindClient {
+					t.Errorf("attempt %d span kind = %s", i, attempt.SpanKind())
+				}
+				// trace context is propagated with attempt span as parent
+				want := "00-" + attempt.SpanContext().TraceID().String() + "-" + attempt.SpanContext().SpanID().String() + "-01"
+				if (*traceparents)[i] != want {
+					t.Errorf("attempt %d traceparent = %q, want %q", i, (*traceparents)[i], want)
+				}
+				wantStatus := http.StatusOK
+				if i < len(tt.statuses) {
+					wantStatus = tt.statuses[i]
+				}
+				if v, _ := spanAttribute(attempt, attrHTTPStatusCode); v.AsInt64() != int64(wantStatus) {
+					t.Errorf("attempt %d http.status_code = %d, want %d", i, v.AsInt64(), wantStatus)
+				}
+			}
+
+			wantAttrs := map[attribute.Key]string{
+				attrEndpoint: "/render/",
+				attrTargets:  "2",
+				attrFrom:     "-1h",
+				attrUntil:    "now",
+				attrFormat:   "json",
+			}
+			if tt.wantErr {
+				if query.Status().Code != codes.Error {
+					t.Errorf("render span status = %v, want error", query.Status())
+				}
+			} else {
+				wantAttrs[attrSeries] = "2"
+				if v, ok := spanAttribute(query, attrResponseSize); !ok || v.AsInt64() == 0 {
+					t.Errorf("render span %s = %v, want response size", attrResponseSize, v.Emit())
+				}
+				if _, ok := spanAttribute(query, attrDecodeTime); !ok {
+					t.Errorf("render span %s not set", attrDecodeTime)
+				}
+			}
+			for key, want := range wantAttrs {
+				if v, _ := spanAttribute(query, key); v.Emit() != want {
+					t.Errorf("render span %s = %q, want %q", key, v.Emit(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestClient_TracingFind(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	client := NewClient("http://" + ts.Listener.Addr().String()).
+		SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	if _, err := client.NewFindQuery("a.*").Request(context.Background()); err != nil {
+		t.Fatalf("Request() error = %v", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 || spans[0].Name() != "HTTP GET" || spans[1].Name() != "graphite /metrics/find" {
+		names := make([]string, 0, len(spans))
+		for _, span := range spans {
+			names = append(names, span.Name())
+		}
+		t.Fatalf("spans = %q, want [HTTP GET, graphite /metrics/find]", names)
+	}
+	if v, _ := spanAttribute(spans[1], attrResponseSize); v.AsInt64() != 2 {
+		t.Errorf("find span %s = %d, want 2", attrResponseSize, v.AsInt64())
+	}
+}
@@ -2,19 +2,66 @@ package graphiteapi
 
 import (
 	"context"
+	"net/url"
 )
 
 // Query is interface for all api request
+//
+// Deprecated: no query implements it, use typed queries (RenderQuery, FindQuery, TagsQuery, etc.),
+// their Request methods return typed responses.
 type Query interface {
 	URL() string
 	Request(ctx context.Context) (Response, error)
 }
 
+// urlQuery is a query with url, used by client request helpers
+type urlQuery interface {
+	URL() (*url.URL, error)
+}
+
+var (
+	_ urlQuery = (*RenderQuery)(nil)
+	_ urlQuery = (*GraphQuery)(nil)
+	_ urlQuery = (*FindQuery)(nil)
+	_ urlQuery = (*ExpandQuery)(nil)
+	_ urlQuery = (*IndexQuery)(nil)
+	_ urlQuery = (*TagsQuery)(nil)
+	_ urlQuery = (*TagValuesQuery)(nil)
+	_ urlQuery = (*FindSeriesQuery)(nil)
+	_ urlQuery = (*AutoCompleteTagsQuery)(nil)
+	_ urlQuery = (*AutoCompleteValuesQuery)(nil)
+	_ urlQuery = (*TagSeriesQuery)(nil)
+	_ urlQuery = (*TagMultiSeriesQuery)(nil)
+	_ urlQuery = (*DelSeriesQuery)(nil)
+)
+
 // Response is interface for all api request response types
 type Response interface {
 	Unmarshal([]byte) error
 }
 
+// RenderFormat is a response format for `/render/` query
+type RenderFormat string
+
+const (
+	RenderFormatJSON          RenderFormat = "json" // default format
+	RenderFormatPickle        RenderFormat = "pickle"
+	RenderFormatProtobuf      RenderFormat = "protobuf" // carbonapi_v2_pb
+	RenderFormatCarbonAPIV3PB RenderFormat = "carbonapi_v3_pb"
+	RenderFormatMsgpack       RenderFormat = "msgpack"
+	RenderFormatCSV           RenderFormat = "csv" // timestamps are formatted in query timezone, so Tz must be set for decode
+)
+
+// RenderMethod is a http method for `/render/` query
+type RenderMethod int8
+
+const (
+	RenderMethodAuto     RenderMethod = iota // GET, or POST with form, if url is longer than client max url length
+	RenderMethodGet                          // GET with parameters in url query
+	RenderMethodPost                         // POST with parameters in application/x-www-form-urlencoded body
+	RenderMethodPostJSON                     // POST with parameters in application/json body (carbonapi)
+)
+
 // RenderQuery is used to build `/render/` query
 type RenderQuery struct {
 	Base          string // base url of graphite server
@@ -24,15 +71,251 @@ type RenderQuery struct {
 	From          string
 	Until         string
 	MaxDataPoints int
+	Format        RenderFormat // response format, json if not set
+	Tz            string       // timezone for from/until and csv timestamps, server default if not set (required for csv decode and TimeRange with absolute time)
+	Method        RenderMethod // http method, RenderMethodAuto if not set
+
+	client *Client // client used for requests, DefaultClient if nil
 }
 
 // DataPoint describes concrete point of time series.
+// Use keyed literals (DataPoint{Value: v, Timestamp: ts}), fields may be added.
 type DataPoint struct {
 	Value     float64
-	Timestamp int64
+	Timestamp int64 // unix timestamp (seconds)
+	Millis    int16 // milliseconds part of timestamp (0 - 999), for backends with millisecond precision
 }
 
+// Series describes time series from render response.
 type Series struct {
-	Target     string
-	DataPoints []DataPoint
+	Target            string
+	Tags              map[string]string // series tags (with `name` tag), nil if not returned
+	PathExpression    string            // path expression from target, empty if not returned
+	XFilesFactor      float64
+	ConsolidationFunc string // consolidation function, empty if not returned
+	Step              int64  // step in seconds, 0 if not returned
+	Start             int64  // start timestamp, 0 if not returned
+	Stop              int64  // stop timestamp, 0 if not returned
+	DataPoints        []DataPoint
+}
+
+// FindFormat is a response format for `/metrics/find` query
+type FindFormat string
+
+const (
+	FindFormatTreeJSON FindFormat = "treejson" // default format
+	FindFormatJSON     FindFormat = "json"
+)
+
+// FindQuery is used to build `/metrics/find` query
+type FindQuery struct {
+	Query     string
+	From      string
+	Until     string
+	Wildcards bool
+	Format    FindFormat
+
+	client *Client // client used for requests, DefaultClient if nil
+}
+
+// FindNode describes node of metrics tree
+type FindNode struct {
+	ID            string // full path of node
+	Text          string // last part of path
+	Leaf          bool
+	Expandable    bool
+	AllowChildren bool
+}
+
+// FindNodes is a `/metrics/find` query response
+type FindNodes []FindNode
+
+// ExpandQuery is used to build `/metrics/expand` query
+type ExpandQuery struct {
+	Queries     []string
+	GroupByExpr bool
+	LeavesOnly  bool
+
+	client *Client // client used for requests, DefaultClient if nil
+}
+
+// ExpandResult is a `/metrics/expand` query response
+type ExpandResult struct {
+	Paths  []string            // expanded paths (without GroupByExpr)
+	Groups map[string][]string // expanded paths, grouped by query (with GroupByExpr)
+}
+
+// IndexQuery is used to build `/metrics/index.json` query
+type IndexQuery struct {
+	client *Client // client used for requests, DefaultClient if nil
+}
+
+// MetricsIndex is a `/metrics/index.json` query response
+type MetricsIndex []string
+
+// TagOp is a tag expression operator
+type TagOp string
+
+const (
+	TagOpEq       TagOp = "="   // tag value is equal
+	TagOpNe       TagOp = "!="  // tag value is not equal
+	TagOpMatch    TagOp = "=~"  // tag value match regex
+	TagOpNotMatch TagOp = "!=~" // tag value not match regex
+)
+
+// TagExpr is a tag expression, used by `/tags/findSeries` and autocomplete queries
+type TagExpr struct {
+	Tag   string
+	Op    TagOp
+	Value string
+}
+
+// TagsQuery is used to build `/tags` query
+type TagsQuery struct {
+	Filter string // regex for filter tags names
+	Limit  int
+
+	client *Client // client used for requests, DefaultClient if nil
+}
+
+// TagNames is a `/tags` query response
+type TagNames []string
+
+// TagValuesQuery is used to build `/tags/<tag>` query
+type TagValuesQuery struct {
+	Tag    string
+	Filter string // regex for filter tag values
+	Limit  int
+
+	client *Client // client used for requests, DefaultClient if nil
+}
+
+// TagValue describes tag value and count of series with it
+type TagValue struct {
+	Value string
+	Count int
+}
+
+// TagValues is a `/tags/<tag>` query response
+type TagValues struct {
+	Tag    string
+	Values []TagValue
+}
+
+// FindSeriesQuery is used to build `/tags/findSeries` query
+type FindSeriesQuery struct {
+	Exprs []TagExpr
+
+	client *Client // client used for requests, DefaultClient if nil
+}
+
+// TaggedSeries is a list of tagged series paths, `/tags/findSeries` and `/tags/tagMultiSeries` query response
+type TaggedSeries []string
+
+// AutoCompleteTagsQuery is used to build `/tags/autoComplete/tags` query
+type AutoCompleteTagsQuery struct {
+	TagPrefix string
+	Exprs     []TagExpr
+	Limit     int
+
+	client *Client // client used for requests, DefaultClient if nil
+}
+
+// AutoCompleteValuesQuery is used to build `/tags/autoComplete/values` query
+type AutoCompleteValuesQuery struct {
+	Tag         string
+	ValuePrefix string
+	Exprs       []TagExpr
+	Limit       int
+
+	client *Client // client used for requests, DefaultClient if nil
+}
+
+// AutoComplete is a `/tags/autoComplete/tags` and `/tags/autoComplete/values` query response
+type AutoComplete []string
+
+// TagSeriesQuery is used to build `/tags/tagSeries` query
+type TagSeriesQuery struct {
+	Path string // tagged series path, like `disk.used;rack=a1;datacenter=dc1`
+
+	client *Client // client used for requests, DefaultClient if nil
+}
+
+// TagMultiSeriesQuery is used to build `/tags/tagMultiSeries` query
+type TagMultiSeriesQuery struct {
+	Paths []string
+
+	client *Client // client used for requests, DefaultClient if nil
+}
+
+// DelSeriesQuery is used to build `/tags/delSeries` query
+type DelSeriesQuery struct {
+	Paths []string
+
+	client *Client // client used for requests, DefaultClient if nil
+}
+
+// GraphFormat is an image format for `/render/` graph query
+type GraphFormat string
+
+const (
+	GraphFormatPNG GraphFormat = "png" // default format
+	GraphFormatSVG GraphFormat = "svg"
+)
+
+// GraphAreaMode is a graph areaMode parameter
+type GraphAreaMode string
+
+const (
+	GraphAreaModeNone    GraphAreaMode = "none"
+	GraphAreaModeFirst   GraphAreaMode = "first"
+	GraphAreaModeAll     GraphAreaMode = "all"
+	GraphAreaModeStacked GraphAreaMode = "stacked"
+)
+
+// GraphLineMode is a graph lineMode parameter
+type GraphLineMode string
+
+const (
+	GraphLineModeSlope     GraphLineMode = "slope"
+	GraphLineModeStaircase GraphLineMode = "staircase"
+	GraphLineModeConnected GraphLineMode = "connected"
+)
+
+// GraphQuery is used to build `/render/` query for graph image.
+// Zero (or nil) parameters are not sent, so graphite defaults are used.
+type GraphQuery struct {
+	Targets     []string
+	From        string
+	Until       string
+	Tz          string
+	Format      GraphFormat
+	Width       int
+	Height      int
+	Title       string
+	VTitle      string
+	VTitleRight string
+	ColorList   []string
+	AreaMode    GraphAreaMode
+	LineMode    GraphLineMode
+	LineWidth   float64
+	YMin        *float64
+	YMax        *float64
+	HideLegend  *bool
+	HideAxes    bool
+	HideGrid    bool
+	GraphOnly   bool
+	Template    string
+	BgColor     string
+	FgColor     string
+	FontSize    float64
+	Params      url.Values // additional render parameters
+
+	client *Client // client used for requests, DefaultClient if nil
+}
+
+// GraphImage is a graph image, returned by GraphQuery
+type GraphImage struct {
+	ContentType string // response content type
+	Data        []byte
 }
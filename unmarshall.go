@@ -1,8 +1,13 @@
 package graphiteapi
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"math"
+	"math/big"
 	"strconv"
+	"strings"
 
 	"github.com/buger/jsonparser"
 )
@@ -15,23 +20,17 @@ func unmarshallSeries(data []byte, maxTargets, maxDataPoints int) ([]Series, err
 	var ie error = nil
 	result := make([]Series, 0, maxTargets)
 	_, err := jsonparser.ArrayEach(data, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
-		if err != nil {
-			return
-		}
-
-		datapoints, e := unmarshallDatapoints(value, maxDataPoints)
-		if e != nil {
-			ie = e
+		if err != nil || ie != nil {
 			return
 		}
 
-		target, e := jsonparser.GetString(value, "target")
+		series, e := unmarshallSerie(value, maxDataPoints)
 		if e != nil {
 			ie = e
 			return
 		}
 
-		result = append(result, Series{Target: target, DataPoints: datapoints})
+		result = append(result, series)
 	})
 
 	if err != nil {
@@ -43,61 +42,497 @@ func unmarshallSeries(data []byte, maxTargets, maxDataPoints int) ([]Series, err
 	return result, nil
 }
 
-func unmarshallDatapoints(data []byte, maxDataPoints int) ([]DataPoint, error) {
-	empty, result := []DataPoint{}, []DataPoint{}
-	rawData, _, _, err := jsonparser.Get(data, "datapoints")
+const (
+	seriesKeyTarget = iota
+	seriesKeyDatapoints
+	seriesKeyTags
+	seriesKeyPathExpression
+	seriesKeyXFilesFactor
+	seriesKeyStep
+	seriesKeyStart
+	seriesKeyStop
+)
+
+var seriesKeys = [][]string{
+	seriesKeyTarget:         {"target"},
+	seriesKeyDatapoints:     {"datapoints"},
+	seriesKeyTags:           {"tags"},
+	seriesKeyPathExpression: {"pathExpression"},
+	seriesKeyXFilesFactor:   {"xFilesFactor"},
+	seriesKeyStep:           {"step"},
+	seriesKeyStart:          {"start"},
+	seriesKeyStop:           {"stop"},
+}
+
+// unmarshallSerie decodes series object. target and datapoints are required, other fields are optional
+func unmarshallSerie(data []byte, maxDataPoints int) (Series, error) {
+	var (
+		series        Series
+		hasTarget     bool
+		hasDatapoints bool
+		ie            error
+		dpErr         error // malformed datapoint error, returned after target is decoded
+	)
+	jsonparser.EachKey(data, func(idx int, value []byte, dataType jsonparser.ValueType, err error) {
+		if ie != nil {
+			return
+		}
+		if err != nil {
+			ie = err
+			return
+		}
+		if dataType == jsonparser.Null {
+			return
+		}
+		switch idx {
+		case seriesKeyTarget:
+			series.Target, ie = jsonparser.ParseString(value)
+			hasTarget = true
+		case seriesKeyDatapoints:
+			series.DataPoints, dpErr = unmarshallDatapoints(value, maxDataPoints)
+			hasDatapoints = true
+		case seriesKeyTags:
+			series.Tags, ie = unmarshallTags(value)
+		case seriesKeyPathExpression:
+			series.PathExpression, ie = jsonparser.ParseString(value)
+		case seriesKeyXFilesFactor:
+			series.XFilesFactor, ie = jsonparser.ParseFloat(value)
+		case seriesKeyStep:
+			series.Step, ie = jsonparser.ParseInt(value)
+		case seriesKeyStart:
+			series.Start, ie = jsonparser.ParseInt(value)
+		case seriesKeyStop:
+			series.Stop, ie = jsonparser.ParseInt(value)
+		}
+	}, seriesKeys...)
+
+	if ie != nil {
+		return Series{}, ie
+	}
+	if dpErr != nil {
+		var pointErr *DatapointError
+		if errors.As(dpErr, &pointErr) {
+			pointErr.Target = series.Target
+		}
+		return Series{}, dpErr
+	}
+	if !hasTarget || !hasDatapoints {
+		return Series{}, jsonparser.KeyPathNotFoundError
+	}
+	return series, nil
+}
+
+// unmarshallTags decodes tags object, not string values are stored as is
+func unmarshallTags(data []byte) (map[string]string, error) {
+	tags := make(map[string]string)
+	err := jsonparser.ObjectEach(data, func(key []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
+		k, err := jsonparser.ParseString(key)
+		if err != nil {
+			return err
+		}
+		if dataType == jsonparser.String {
+			if tags[k], err = jsonparser.ParseString(value); err != nil {
+				return err
+			}
+		} else {
+			tags[k] = string(value)
+		}
+		return nil
+	})
 	if err != nil {
-		return empty, err
+		return nil, err
+	}
+	return tags, nil
+}
+
+// datapointsCapacity returns capacity for datapoints slice: count of points in array.
+// Not limited by maxDataPoints, server may return more points (and slice growth is more expensive than count).
+func datapointsCapacity(data []byte) int {
+	// each point is an array, so count of '[' (except the outer one) is a count of points
+	n := bytes.Count(data, []byte{'['}) - 1
+	if n <= 0 {
+		return 0
+	}
+	return n
+}
+
+// isJSONSpace checks for json whitespace
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// skipJSONSpaces returns position of the first not space byte from pos
+func skipJSONSpaces(data []byte, pos int) int {
+	for pos < len(data) && isJSONSpace(data[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// jsonToken returns scalar token (number or literal) from pos and position after it
+func jsonToken(data []byte, pos int) ([]byte, int) {
+	start := pos
+	for pos < len(data) {
+		c := data[pos]
+		if c == ',' || c == ']' || isJSONSpace(c) {
+			break
+		}
+		pos++
+	}
+	return data[start:pos], pos
+}
+
+// unmarshallDatapoints decodes datapoints array [[value, timestamp], ...] with single allocation for result
+// (values and timestamps are parsed without allocations). Malformed datapoint is returned as DatapointError (without target).
+func unmarshallDatapoints(data []byte, maxDataPoints int) ([]DataPoint, error) {
+	pos := skipJSONSpaces(data, 0)
+	if pos == len(data) || data[pos] != '[' {
+		return []DataPoint{}, jsonparser.MalformedArrayError
+	}
+	pos = skipJSONSpaces(data, pos+1)
+	if pos < len(data) && data[pos] == ']' {
+		return []DataPoint{}, nil
 	}
 
-	_, err = jsonparser.ArrayEach(rawData, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+	result := make([]DataPoint, 0, datapointsCapacity(data))
+	for {
+		point, next, err := unmarshallDatapoint(data, pos)
 		if err != nil {
+			return []DataPoint{}, &DatapointError{Index: len(result), Err: err}
+		}
+		result = append(result, point)
+
+		pos = skipJSONSpaces(data, next)
+		if pos == len(data) {
+			return []DataPoint{}, jsonparser.MalformedArrayError
+		}
+		switch data[pos] {
+		case ',':
+			pos = skipJSONSpaces(data, pos+1)
+		case ']':
+			return result, nil
+		default:
+			return []DataPoint{}, jsonparser.MalformedArrayError
+		}
+	}
+}
+
+// unmarshallDatapoint decodes datapoint [value, timestamp] from pos, returns position after it
+func unmarshallDatapoint(data []byte, pos int) (DataPoint, int, error) {
+	var (
+		point DataPoint
+		token []byte
+		err   error
+	)
+	if pos == len(data) || data[pos] != '[' {
+		return point, pos, ErrDatapointInvalid
+	}
+
+	pos = skipJSONSpaces(data, pos+1)
+	token, pos = jsonToken(data, pos)
+	if string(token) == "null" {
+		point.Value = math.NaN()
+	} else if point.Value, err = jsonparser.ParseFloat(token); err != nil {
+		return point, pos, ErrDatapointValue
+	}
+
+	pos = skipJSONSpaces(data, pos)
+	if pos == len(data) || data[pos] != ',' {
+		return point, pos, ErrDatapointInvalid
+	}
+	pos = skipJSONSpaces(data, pos+1)
+	token, pos = jsonToken(data, pos)
+	if point.Timestamp, point.Millis, err = parseTimestamp(token); err != nil {
+		return point, pos, err
+	}
+
+	pos = skipJSONSpaces(data, pos)
+	if pos == len(data) || data[pos] != ']' {
+		return point, pos, ErrDatapointInvalid
+	}
+	return point, pos + 1, nil
+}
+
+// millisTimestampMin is a min absolute timestamp value, treated as milliseconds (seconds timestamp is after year 5000)
+const millisTimestampMin = 100000000000
+
+// parseTimestamp parses integer or float timestamp in seconds or milliseconds (detected by value),
+// returns seconds and milliseconds part
+func parseTimestamp(token []byte) (int64, int16, error) {
+	if ts, err := jsonparser.ParseInt(token); err == nil {
+		if ts < millisTimestampMin && ts > -millisTimestampMin {
+			return ts, 0, nil
+		}
+		return splitMillis(ts)
+	}
+
+	f, err := jsonparser.ParseFloat(token)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, 0, ErrDatapointTimestamp
+	}
+	if f < millisTimestampMin && f > -millisTimestampMin {
+		f *= 1000
+	}
+	f = math.Round(f)
+	if f >= math.MaxInt64 || f < math.MinInt64 {
+		return 0, 0, ErrDatapointTimestamp
+	}
+	return splitMillis(int64(f))
+}
+
+// splitMillis splits milliseconds timestamp into seconds and milliseconds part
+func splitMillis(ms int64) (int64, int16, error) {
+	sec, millis := ms/1000, ms%1000
+	if millis < 0 {
+		sec--
+		millis += 1000
+	}
+	return sec, int16(millis), nil
+}
+
+func unmarshallFindNodes(data []byte) (FindNodes, error) {
+	result := FindNodes{}
+	if len(data) == 0 {
+		return result, nil
+	}
+	var ie error
+	_, err := jsonparser.ArrayEach(data, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		if err != nil || ie != nil {
 			return
 		}
-		datapoint, e := unmarshallDatapoint(value)
+		node, e := unmarshallFindNode(value)
 		if e != nil {
-			err = e
+			ie = e
 			return
 		}
-		result = append(result, datapoint)
+		result = append(result, node)
 	})
 	if err != nil {
-		return empty, err
+		return FindNodes{}, err
+	}
+	if ie != nil {
+		return FindNodes{}, ie
 	}
 	return result, nil
 }
 
-func unmarshallDatapoint(data []byte) (DataPoint, error) {
-	empty, result := DataPoint{}, DataPoint{}
-	var err error
-	position := 0
-	_, err = jsonparser.ArrayEach(data, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+// unmarshallFindNode decodes treejson node or json (graphite-web) node
+func unmarshallFindNode(data []byte) (FindNode, error) {
+	var (
+		node FindNode
+		err  error
+	)
+	if node.ID, err = jsonparser.GetString(data, "id"); err == nil {
+		if node.Text, err = jsonparser.GetString(data, "text"); err != nil {
+			return FindNode{}, err
+		}
+		if node.Leaf, err = unmarshallBool(data, "leaf"); err != nil {
+			return FindNode{}, err
+		}
+		if node.Expandable, err = unmarshallBool(data, "expandable"); err != nil {
+			return FindNode{}, err
+		}
+		if node.AllowChildren, err = unmarshallBool(data, "allowChildren"); err != nil {
+			return FindNode{}, err
+		}
+		return node, nil
+	} else if err != jsonparser.KeyPathNotFoundError {
+		return FindNode{}, err
+	}
+
+	if node.ID, err = jsonparser.GetString(data, "path"); err != nil {
+		return FindNode{}, err
+	}
+	if node.Leaf, err = unmarshallBool(data, "is_leaf"); err != nil {
+		return FindNode{}, err
+	}
+	node.Text = node.ID[strings.LastIndexByte(node.ID, '.')+1:]
+	node.Expandable = !node.Leaf
+	node.AllowChildren = !node.Leaf
+	return node, nil
+}
+
+// unmarshallBool decodes bool, encoded as bool, number or string (graphite-web use 0/1 in some responses)
+func unmarshallBool(data []byte, key string) (bool, error) {
+	value, dataType, _, err := jsonparser.Get(data, key)
+	if err != nil {
+		return false, err
+	}
+	switch dataType {
+	case jsonparser.Boolean:
+		return jsonparser.ParseBoolean(value)
+	case jsonparser.Number, jsonparser.String:
+		v, err := strconv.ParseFloat(string(value), 64)
 		if err != nil {
+			return false, err
+		}
+		return v != 0, nil
+	default:
+		return false, jsonparser.MalformedValueError
+	}
+}
+
+// unmarshallStrings decodes array of strings
+func unmarshallStrings(data []byte) ([]string, error) {
+	result := []string{}
+	if len(data) == 0 {
+		return result, nil
+	}
+	var ie error
+	_, err := jsonparser.ArrayEach(data, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		if err != nil || ie != nil {
 			return
 		}
-		if position == 0 {
-			if dataType == jsonparser.Null {
-				result.Value = math.NaN()
-			} else {
-				v, e := strconv.ParseFloat(string(value), 64)
-				if e != nil {
-					err = e
-					return
-				}
-				result.Value = v
-			}
-		} else {
-			ts, e := strconv.ParseInt(string(value), 10, 32)
-			if err != nil {
-				err = e
-				return
-			}
-			result.Timestamp = ts
+		if dataType != jsonparser.String {
+			ie = jsonparser.MalformedStringError
+			return
 		}
-		position++
+		s, e := jsonparser.ParseString(value)
+		if e != nil {
+			ie = e
+			return
+		}
+		result = append(result, s)
 	})
 	if err != nil {
-		return empty, err
+		return []string{}, err
+	}
+	if ie != nil {
+		return []string{}, ie
 	}
 	return result, nil
 }
+
+// unmarshallExpand decodes `/metrics/expand` response: {"results": [paths]} or {"results": {query: [paths]}} (with groupByExpr)
+func unmarshallExpand(data []byte) ([]string, map[string][]string, error) {
+	if len(data) == 0 {
+		return []string{}, nil, nil
+	}
+	value, dataType, _, err := jsonparser.Get(data, "results")
+	if err != nil {
+		return nil, nil, err
+	}
+	switch dataType {
+	case jsonparser.Array:
+		paths, err := unmarshallStrings(value)
+		return paths, nil, err
+	case jsonparser.Object:
+		groups := make(map[string][]string)
+		err = jsonparser.ObjectEach(value, func(key []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
+			query, err := jsonparser.ParseString(key)
+			if err != nil {
+				return err
+			}
+			if groups[query], err = unmarshallStrings(value); err != nil {
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, groups, nil
+	default:
+		return nil, nil, jsonparser.UnknownValueTypeError
+	}
+}
+
+func infoToInt64(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func infoToFloat64(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case nil:
+		return math.NaN(), true
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+func infoToList(v interface{}) ([]interface{}, bool) {
+	switch v := v.(type) {
+	case []interface{}:
+		return v, true
+	case *pickleList:
+		return v.items, true
+	default:
+		return nil, false
+	}
+}
+
+// unmarshallSeriesInfo converts decoded series info (pickle and msgpack formats) into Series:
+// map with name, start, end, step, values and optional pathExpression, xFilesFactor, tags
+func unmarshallSeriesInfo(v interface{}, format string) (Series, error) {
+	var (
+		series Series
+		ok     bool
+	)
+	d, ok := v.(map[string]interface{})
+	if !ok {
+		return Series{}, fmt.Errorf("%s: series info is not a map", format)
+	}
+	if series.Target, ok = d["name"].(string); !ok {
+		return Series{}, fmt.Errorf("%s: series name not found", format)
+	}
+	if series.Start, ok = infoToInt64(d["start"]); !ok {
+		return Series{}, fmt.Errorf("%s: series %s start not found", format, series.Target)
+	}
+	if series.Stop, ok = infoToInt64(d["end"]); !ok {
+		return Series{}, fmt.Errorf("%s: series %s end not found", format, series.Target)
+	}
+	if series.Step, ok = infoToInt64(d["step"]); !ok {
+		return Series{}, fmt.Errorf("%s: series %s step not found", format, series.Target)
+	}
+	values, ok := infoToList(d["values"])
+	if !ok {
+		return Series{}, fmt.Errorf("%s: series %s values not found", format, series.Target)
+	}
+	if pathExpression, ok := d["pathExpression"].(string); ok {
+		series.PathExpression = pathExpression
+	}
+	if xFilesFactor, ok := infoToFloat64(d["xFilesFactor"]); ok && d["xFilesFactor"] != nil {
+		series.XFilesFactor = xFilesFactor
+	}
+	if tags, ok := d["tags"].(map[string]interface{}); ok {
+		series.Tags = make(map[string]string, len(tags))
+		for k, v := range tags {
+			series.Tags[k] = fmt.Sprint(v)
+		}
+	}
+
+	series.DataPoints = make([]DataPoint, len(values))
+	ts := series.Start
+	for i, value := range values {
+		if series.DataPoints[i].Value, ok = infoToFloat64(value); !ok {
+			return Series{}, fmt.Errorf("%s: series %s has invalid value type %T", format, series.Target, value)
+		}
+		series.DataPoints[i].Timestamp = ts
+		ts += series.Step
+	}
+
+	return series, nil
+}
@@ -1,9 +1,16 @@
 package graphiteapi
 
 import (
+	"errors"
+	"io/ioutil"
 	"math"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/buger/jsonparser"
 )
 
 var testUnmarshallMetricsCases = []struct {
@@ -29,6 +36,33 @@ var testUnmarshallMetricsCases = []struct {
 		},
 		Err: nil,
 	},
+	{
+		Json: `[{"target": "seriesByTag('name=main')", "tags": {"name": "main", "dc": "dc1", "rack": 1},` +
+			` "pathExpression": "seriesByTag('name=main')", "xFilesFactor": 0.5, "step": 60, "start": 1468339800, "stop": 1468339980,` +
+			` "datapoints": [[1, 1468339800], [null, 1468339860], [2, 1468339920]]}]`,
+		Result: []Series{
+			{
+				Target:         "seriesByTag('name=main')",
+				Tags:           map[string]string{"name": "main", "dc": "dc1", "rack": "1"},
+				PathExpression: "seriesByTag('name=main')",
+				XFilesFactor:   0.5,
+				Step:           60,
+				Start:          1468339800,
+				Stop:           1468339980,
+				DataPoints: []DataPoint{
+					{Value: 1.0, Timestamp: 1468339800},
+					{Value: math.NaN(), Timestamp: 1468339860},
+					{Value: 2.0, Timestamp: 1468339920},
+				},
+			},
+		},
+		Err: nil,
+	},
+	{
+		Json:   `[{"datapoints": [[1, 1468339800]]}]`,
+		Result: []Series{},
+		Err:    jsonparser.KeyPathNotFoundError,
+	},
 }
 
 func TestUnmarshallMetrics(t *testing.T) {
@@ -43,3 +77,216 @@ func TestUnmarshallMetrics(t *testing.T) {
 		})
 	}
 }
+
+// makeDatapointsJSON returns json datapoints array with n points (every 10th is null)
+func makeDatapointsJSON(n int) []byte {
+	buf := make([]byte, 0, n*24)
+	buf = append(buf, '[')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			buf = append(buf, ", "...)
+		}
+		buf = append(buf, '[')
+		if i%10 == 9 {
+			buf = append(buf, "null"...)
+		} else {
+			buf = strconv.AppendFloat(buf, float64(i)*1.5, 'f', -1, 64)
+		}
+		buf = append(buf, ", "...)
+		buf = strconv.AppendInt(buf, 1468339800+int64(i)*60, 10)
+		buf = append(buf, ']')
+	}
+	return append(buf, ']')
+}
+
+func TestUnmarshallDatapoints_Allocs(t *testing.T) {
+	const points = 1000
+	data := makeDatapointsJSON(points)
+	// maxDataPoints less than points count (server may ignore it)
+	for _, maxDataPoints := range []int{0, points, points / 2} {
+		allocs := testing.AllocsPerRun(10, func() {
+			if _, err := unmarshallDatapoints(data, maxDataPoints); err != nil {
+				t.Fatal(err)
+			}
+		})
+		// only result slice is allocated
+		if allocs > 1 {
+			t.Errorf("unmarshallDatapoints(maxDataPoints = %d) allocs = %v, want 1", maxDataPoints, allocs)
+		}
+	}
+}
+
+func TestUnmarshallDatapoints_Capacity(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          string
+		maxDataPoints int
+		wantCap       int
+	}{
+		{name: "short series with large maxDataPoints", data: `[[1, 1468339853]]`, maxDataPoints: 1000000, wantCap: 1},
+		{name: "without maxDataPoints", data: `[[1, 1468339853], [2, 1468339854]]`, wantCap: 2},
+		{name: "empty", data: `[]`, maxDataPoints: 1000000, wantCap: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unmarshallDatapoints([]byte(tt.data), tt.maxDataPoints)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cap(got) > tt.wantCap {
+				t.Errorf("unmarshallDatapoints() cap = %d, want <= %d", cap(got), tt.wantCap)
+			}
+		})
+	}
+
+	// stream decoder
+	it := newSeriesIterator(ioutil.NopCloser(strings.NewReader(`[{"target": "a.b", "datapoints": [[1, 1468339853]]}]`)),
+		RenderFormatJSON, 1000000, time.UTC)
+	defer it.Close()
+	if !it.Next() {
+		t.Fatalf("Next() = false, err = %v", it.Err())
+	}
+	if c := cap(it.Series().DataPoints); c > 1 {
+		t.Errorf("streamed series cap = %d, want 1", c)
+	}
+}
+
+func BenchmarkUnmarshallDatapoints(b *testing.B) {
+	tests := []struct {
+		points        int
+		maxDataPoints int
+	}{
+		{points: 100, maxDataPoints: 100},
+		{points: 10000, maxDataPoints: 10000},
+		// server returns more points than maxDataPoints
+		{points: 10000, maxDataPoints: 1000},
+	}
+	for _, tt := range tests {
+		data := makeDatapointsJSON(tt.points)
+		maxDataPoints := tt.maxDataPoints
+		b.Run(strconv.Itoa(tt.points)+"_max"+strconv.Itoa(maxDataPoints), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := unmarshallDatapoints(data, maxDataPoints); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(testing.AllocsPerRun(1, func() { unmarshallDatapoints(data, maxDataPoints) }))/float64(tt.points), "allocs/point")
+		})
+	}
+}
+
+func BenchmarkUnmarshallSeries(b *testing.B) {
+	const (
+		targets = 10
+		points  = 1000
+	)
+	datapoints := makeDatapointsJSON(points)
+	data := []byte{'['}
+	for i := 0; i < targets; i++ {
+		if i > 0 {
+			data = append(data, ',')
+		}
+		data = append(data, `{"target": "metric.name.`...)
+		data = strconv.AppendInt(data, int64(i), 10)
+		data = append(data, `", "tags": {"name": "metric"}, "datapoints": `...)
+		data = append(data, datapoints...)
+		data = append(data, '}')
+	}
+	data = append(data, ']')
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if _, err := unmarshallSeries(data, targets, points); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestUnmarshallDatapoints_Timestamp(t *testing.T) {
+	tests := []struct {
+		json string
+		want []DataPoint
+	}{
+		{
+			// after 2038
+			json: `[[1, 4102444800], [2, 9223372036]]`,
+			want: []DataPoint{{Value: 1, Timestamp: 4102444800}, {Value: 2, Timestamp: 9223372036}},
+		},
+		{
+			json: `[[1, 1468339853123], [2, 1468339853000]]`,
+			want: []DataPoint{{Value: 1, Timestamp: 1468339853, Millis: 123}, {Value: 2, Timestamp: 1468339853}},
+		},
+		{
+			json: `[[1, 1468339853.5], [2, 1468339853123.0], [3, 1.468339853e9]]`,
+			want: []DataPoint{
+				{Value: 1, Timestamp: 1468339853, Millis: 500},
+				{Value: 2, Timestamp: 1468339853, Millis: 123},
+				{Value: 3, Timestamp: 1468339853},
+			},
+		},
+		{
+			json: `[[1, -1], [2, -1500.5], [3, -1500]]`,
+			want: []DataPoint{
+				{Value: 1, Timestamp: -1},
+				{Value: 2, Timestamp: -1501, Millis: 500},
+				{Value: 3, Timestamp: -1500},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			got, err := unmarshallDatapoints([]byte(tt.json), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unmarshallDatapoints() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDataPoint_Time(t *testing.T) {
+	p := DataPoint{Timestamp: 1468339853, Millis: 123}
+	if got, want := p.Time(), time.Unix(1468339853, 123000000); !got.Equal(want) {
+		t.Errorf("Time() = %v, want %v", got, want)
+	}
+	if got, want := p.UnixMilli(), int64(1468339853123); got != want {
+		t.Errorf("UnixMilli() = %d, want %d", got, want)
+	}
+}
+
+func TestUnmarshallSeries_DatapointError(t *testing.T) {
+	tests := []struct {
+		json      string
+		wantIndex int
+		wantErr   error
+	}{
+		{json: `[[1, 1], [2, "x"]]`, wantIndex: 1, wantErr: ErrDatapointTimestamp},
+		{json: `[[1, 1], [2, 2], [3, 9223372036854775808]]`, wantIndex: 2, wantErr: ErrDatapointTimestamp},
+		{json: `[["a", 1]]`, wantIndex: 0, wantErr: ErrDatapointValue},
+		{json: `[[1, 1], 2]`, wantIndex: 1, wantErr: ErrDatapointInvalid},
+		{json: `[[1, 1, 3]]`, wantIndex: 0, wantErr: ErrDatapointInvalid},
+		{json: `[[1]]`, wantIndex: 0, wantErr: ErrDatapointInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			// datapoints before target
+			data := `[{"datapoints": ` + tt.json + `, "target": "a.b"}]`
+			_, err := unmarshallSeries([]byte(data), 0, 0)
+			var pointErr *DatapointError
+			if !errors.As(err, &pointErr) {
+				t.Fatalf("unmarshallSeries() error = %v, want *DatapointError", err)
+			}
+			if pointErr.Target != "a.b" || pointErr.Index != tt.wantIndex {
+				t.Errorf("DatapointError = %+v, want target a.b and index %d", pointErr, tt.wantIndex)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("unmarshallSeries() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}